@@ -0,0 +1,135 @@
+package tpl
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// AnswersSource reads the answers saved by earlier interactive sessions.
+// The answers only set the keys without values, so they are not asked again.
+// A missing file gives no answers
+type AnswersSource struct {
+	Path string
+}
+
+// Name returns the path of the file
+func (s *AnswersSource) Name() string {
+	return s.Path
+}
+
+// Load reads and parses the file
+func (s *AnswersSource) Load(tmpl *Tmpl) (map[string]interface{}, error) {
+	return readAnswers(s.Path)
+}
+
+func (s *AnswersSource) precedence() string {
+	return EnvPrecedenceGaps
+}
+
+func readAnswers(file string) (map[string]interface{}, error) {
+	dat, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return make(map[string]interface{}), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read answers '%s': %v", file, err)
+	}
+	return parseData(dat, detectFormat(file, lookupFormatOrYaml("")), file, false)
+}
+
+// saveAnswers adds the values input in interactive mode to the answers file,
+// which is replaced atomically. The values of secret keys are not saved
+func (tmpl *Tmpl) saveAnswers(dataFlattenMap map[string]interface{}) error {
+	file := tmpl.TmplOpts.Answers
+	answers, err := readAnswers(file)
+	if err != nil {
+		return err
+	}
+	flat := make(map[string]interface{})
+	nestedToFlattenMap(answers, flat, "", false)
+	changed := false
+	for key, f := range tmpl.inputs {
+		if !f.Secret {
+			flat[key] = dataFlattenMap[key]
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	format := detectFormat(file, lookupFormatOrYaml(""))
+	out, err := format.Marshal(expand(flat))
+	if err != nil {
+		return fmt.Errorf("failed to marshal answers to %s: %v", format.Name, err)
+	}
+	err = WriteFileAtomic(file, out, 0)
+	if err != nil {
+		return fmt.Errorf("failed to save answers '%s': %v", file, err)
+	}
+	return nil
+}
+
+// noTTYPrompter never reads stdin. It takes the defaults and fails for the keys without them
+type noTTYPrompter struct{}
+
+// Ask returns the defaults of the fields
+func (noTTYPrompter) Ask(q *Question) ([]string, error) {
+	fields := questionFields(q)
+	values := make([]string, len(fields))
+	for i, f := range fields {
+		if !f.HasDefault {
+			return nil, errors.New("no terminal to input the value")
+		}
+		if f.Validate != nil {
+			if err := f.Validate(f.Default); err != nil {
+				return nil, err
+			}
+		}
+		values[i] = f.Default
+	}
+	return values, nil
+}
+
+// Confirm fails, as there is no terminal to answer
+func (noTTYPrompter) Confirm(message string) (bool, error) {
+	return false, fmt.Errorf("no terminal to answer '%s'", message)
+}
+
+// unansweredKeysError lists the keys that need input but have no terminal to input them
+type unansweredKeysError struct {
+	refs []*KeyRef
+}
+
+func (e *unansweredKeysError) Error() string {
+	lines := []string{"unanswered keys found without a terminal:"}
+	for _, ref := range e.refs {
+		lines = append(lines, fmt.Sprintf("  %s (%s:%d)", ref.Key, ref.File, ref.Line))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// checkAnswered fails listing every key of the template files that would be asked
+// without a default
+func (tmpl *Tmpl) checkAnswered(dataFlattenMap map[string]interface{}) error {
+	questions, err := tmpl.allQuestions(dataFlattenMap)
+	if err != nil {
+		return err
+	}
+	refs := []*KeyRef{}
+	seen := make(map[string]bool)
+	for _, q := range questions {
+		for i, f := range q.Fields {
+			if !f.HasDefault && !seen[f.Key] {
+				seen[f.Key] = true
+				refs = append(refs, q.Keys[i])
+			}
+		}
+	}
+	if len(refs) > 0 {
+		return &unansweredKeysError{refs}
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package tpl
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// defaultFileMode is used for a new file written without mode
+const defaultFileMode os.FileMode = 0644
+
+// writeTempFile writes the content to a temporary file in the directory of dst
+// and returns its path
+func writeTempFile(dst string, content string, mode os.FileMode) (string, error) {
+	f, err := ioutil.TempFile(filepath.Dir(dst), "."+filepath.Base(dst)+".tpl-")
+	if err != nil {
+		return "", err
+	}
+	tmp := f.Name()
+	_, err = f.WriteString(content)
+	if err == nil {
+		err = f.Chmod(mode)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	return tmp, nil
+}
+
+// fileModeOrDefault returns the mode, or the mode of the existing file if mode is 0
+func fileModeOrDefault(dst string, mode os.FileMode) os.FileMode {
+	if mode != 0 {
+		return mode
+	}
+	if fi, err := os.Stat(dst); err == nil {
+		return fi.Mode().Perm()
+	}
+	return defaultFileMode
+}
+
+// reserveTempName creates an empty temporary file next to dst to use its name
+func reserveTempName(dst string, suffix string) (string, error) {
+	f, err := ioutil.TempFile(filepath.Dir(dst), "."+filepath.Base(dst)+suffix)
+	if err != nil {
+		return "", err
+	}
+	name := f.Name()
+	return name, f.Close()
+}
+
+// mkdirAll creates the directory and its parents, and returns the created directories
+// from the deepest one
+func mkdirAll(dir string) ([]string, error) {
+	created := []string{}
+	for d := dir; d != "." && d != string(os.PathSeparator); d = filepath.Dir(d) {
+		if _, err := os.Stat(d); err == nil {
+			break
+		}
+		created = append(created, d)
+		if filepath.Dir(d) == d {
+			break
+		}
+	}
+	return created, os.MkdirAll(dir, os.ModePerm)
+}
+
+// WriteFileAtomic writes the content to a temporary file and renames it to dst,
+// so that dst is never left partially written.
+// The mode of an existing file is kept if mode is 0
+func WriteFileAtomic(dst string, content string, mode os.FileMode) error {
+	tmp, err := writeTempFile(dst, content, fileModeOrDefault(dst, mode))
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmp, dst)
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// FileTx writes files all or nothing.
+// Staged files are written to temporary files, and they are renamed into place on commit.
+// If a rename fails, the files already renamed are rolled back
+type FileTx struct {
+	files []*txFile
+	dirs  []string
+}
+
+type txFile struct {
+	dst       string
+	tmp       string
+	backup    string
+	committed bool
+}
+
+// Stage writes the content to a temporary file next to dst
+func (tx *FileTx) Stage(dst string, content string, mode os.FileMode) error {
+	dirs, err := mkdirAll(filepath.Dir(dst))
+	tx.dirs = append(dirs, tx.dirs...)
+	if err != nil {
+		return err
+	}
+	tmp, err := writeTempFile(dst, content, fileModeOrDefault(dst, mode))
+	if err != nil {
+		return err
+	}
+	tx.files = append(tx.files, &txFile{dst: dst, tmp: tmp})
+	return nil
+}
+
+// Commit renames all staged files into place, keeping backups of existing files
+// until every file is renamed
+func (tx *FileTx) Commit() error {
+	for _, f := range tx.files {
+		if _, err := os.Stat(f.dst); err == nil {
+			backup, err := reserveTempName(f.dst, ".tpl-bak-")
+			if err == nil {
+				err = os.Rename(f.dst, backup)
+			}
+			if err != nil {
+				os.Remove(backup)
+				tx.Rollback()
+				return err
+			}
+			f.backup = backup
+		}
+		err := os.Rename(f.tmp, f.dst)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		f.committed = true
+	}
+	for _, f := range tx.files {
+		if f.backup != "" {
+			os.Remove(f.backup)
+		}
+	}
+	tx.files = nil
+	tx.dirs = nil
+	return nil
+}
+
+// Rollback removes the temporary files, restores the files already renamed
+// and removes the directories created by Stage
+func (tx *FileTx) Rollback() error {
+	var rerr error
+	for i := len(tx.files) - 1; i >= 0; i-- {
+		f := tx.files[i]
+		var err error
+		switch {
+		case !f.committed:
+			os.Remove(f.tmp)
+			if f.backup != "" {
+				err = os.Rename(f.backup, f.dst)
+			}
+		case f.backup != "":
+			err = os.Rename(f.backup, f.dst)
+		default:
+			err = os.Remove(f.dst)
+		}
+		if err != nil && rerr == nil {
+			rerr = err
+		}
+	}
+	for _, d := range tx.dirs {
+		os.Remove(d)
+	}
+	tx.files = nil
+	tx.dirs = nil
+	return rerr
+}
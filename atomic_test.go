@@ -0,0 +1,157 @@
+package tpl
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "tpl-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// dirFiles lists the files under dir relative to it
+func dirFiles(t *testing.T, dir string) []string {
+	files := []string{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != dir {
+			rel, _ := filepath.Rel(dir, path)
+			files = append(files, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	return files
+}
+
+func readString(t *testing.T, file string) string {
+	dat, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(dat)
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	dst := filepath.Join(dir, "a")
+	if err := WriteFileAtomic(dst, "one", 0600); err != nil {
+		t.Fatal(err)
+	}
+	// the mode of the existing file is kept
+	if err := WriteFileAtomic(dst, "two", 0); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("mode = %v, want 0600", fi.Mode().Perm())
+	}
+	if got := readString(t, dst); got != "two" {
+		t.Errorf("content = %q, want two", got)
+	}
+	if files := dirFiles(t, dir); len(files) != 1 {
+		t.Errorf("temporary files are left: %v", files)
+	}
+}
+
+func TestFileTxCommit(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	a := filepath.Join(dir, "a")
+	b := filepath.Join(dir, "sub", "b")
+	ioutil.WriteFile(a, []byte("old"), 0644)
+	tx := &FileTx{}
+	if err := tx.Stage(a, "new a", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Stage(b, "new b", 0); err != nil {
+		t.Fatal(err)
+	}
+	if got := readString(t, a); got != "old" {
+		t.Errorf("a is changed before commit: %q", got)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readString(t, a); got != "new a" {
+		t.Errorf("a = %q, want new a", got)
+	}
+	if got := readString(t, b); got != "new b" {
+		t.Errorf("b = %q, want new b", got)
+	}
+	want := []string{"a", "sub", filepath.Join("sub", "b")}
+	if files := dirFiles(t, dir); !reflect.DeepEqual(files, want) {
+		t.Errorf("files = %v, want %v", files, want)
+	}
+}
+
+func TestFileTxRollback(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	a := filepath.Join(dir, "a")
+	ioutil.WriteFile(a, []byte("old"), 0644)
+	tx := &FileTx{}
+	if err := tx.Stage(a, "new a", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Stage(filepath.Join(dir, "x", "y", "b"), "new b", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readString(t, a); got != "old" {
+		t.Errorf("a = %q, want old", got)
+	}
+	// the temporary files and the created directories are removed
+	if files := dirFiles(t, dir); len(files) != 1 || files[0] != "a" {
+		t.Errorf("files = %v, want [a]", files)
+	}
+}
+
+func TestFileTxCommitFailure(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	a := filepath.Join(dir, "a")
+	b := filepath.Join(dir, "b")
+	ioutil.WriteFile(a, []byte("old"), 0644)
+	tx := &FileTx{}
+	if err := tx.Stage(a, "new a", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Stage(b, "new b", 0); err != nil {
+		t.Fatal(err)
+	}
+	// a directory in place of b fails the commit after a is renamed
+	if err := os.MkdirAll(filepath.Join(b, "c"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err == nil {
+		t.Fatal("commit succeeded, want error")
+	}
+	if got := readString(t, a); got != "old" {
+		t.Errorf("a = %q, want old restored", got)
+	}
+	want := []string{"a", "b", filepath.Join("b", "c")}
+	files := dirFiles(t, dir)
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("files = %v, want %v", files, want)
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright © 2018 byung2
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/byung2/tpl"
+	"github.com/spf13/cobra"
+)
+
+func newDataCommand() *cobra.Command {
+	var opts tpl.TmplOpts
+	var sources bool
+	createCmd := &cobra.Command{
+		Use:   "data [OPTIONS] [TMPL_FILE|TMPL_DIR...]",
+		Short: "Show the merged data object",
+		Long: `Show the data object merged from the data files and the environment variables.
+With --sources, show every key with its value and the data file or 'env' it came from.
+TMPL FILES are only used to find the keys of the environment variables to load`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts.TmplFiles = args
+			return data(&opts, sources)
+		},
+	}
+	createCmd.Flags().StringVarP(&opts.DataFilesStr, "datafile", "d", "", `Colon separated files containing data objects.
+'-' reads stdin and http(s) URLs are downloaded.
+They are merged in the order listed, see --merge`)
+	addDataFlags(createCmd, &opts)
+	addTmplFlags(createCmd, &opts)
+	createCmd.Flags().StringVarP(&opts.DataOutFormat, "output-format", "t", "yaml", "Output format for data object. Keys are sorted in every format.\nOne of "+strings.Join(tpl.FormatNames(), ", ")+", or schema for a starter JSON Schema")
+	createCmd.Flags().StringVarP(&opts.DataOutFile, "out", "o", "", "Output file to store the data object. Omit to use stdout")
+	createCmd.Flags().BoolVarP(&sources, "sources", "s", false, "Show the source of each key instead of the data object")
+	return createCmd
+}
+
+func data(opts *tpl.TmplOpts, sources bool) error {
+	tmpl, err := opts.OptsToTmpl()
+	if err != nil {
+		return err
+	}
+	if sources {
+		tmpl.WriteDataObject(tmpl.SourceReport())
+		return nil
+	}
+	dataOut, err := tmpl.DataObject()
+	if err != nil {
+		return fmt.Errorf("failed to export data object: %v", err)
+	}
+	tmpl.WriteDataObject(dataOut)
+	return nil
+}
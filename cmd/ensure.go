@@ -15,7 +15,9 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/byung2/tpl"
 	"github.com/spf13/cobra"
@@ -24,8 +26,8 @@ import (
 func newEnsureCommand() *cobra.Command {
 	var opts tpl.TmplOpts
 	createCmd := &cobra.Command{
-		Use:   "ensure [OPTIONS] TMPL_FILE [TMPL_FILE...]",
-		Short: "Check for missing keys",
+		Use:   "ensure [OPTIONS] TMPL_FILE|TMPL_DIR [TMPL_FILE|TMPL_DIR...]",
+		Short: "Check for missing keys and validate the data against the schema",
 		//Long:  `Check for missing keys`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			err := RequiresMinArgs(cmd, args, 1)
@@ -36,12 +38,12 @@ func newEnsureCommand() *cobra.Command {
 			return ensure(&opts)
 		},
 	}
-	createCmd.Flags().StringVarP(&opts.DataFilesStr, "datafile", "d", "", "Colon separated files containing data objects")
-	createCmd.Flags().BoolVarP(&opts.UseEnv, "env", "e", false, "Load the environment variables into the data objects")
-	createCmd.Flags().StringVarP(&opts.UseEnvFromPrefix, "env-prefix", "p", "", `Key prefix to load environment variables.
-If a template key has a dot chain of the given value as a prefix,
-load the corresponding environment variable into the data objects`)
-	createCmd.Flags().StringVarP(&opts.DataFormat, "format", "f", "yaml", "Default format for input data file without extention")
+	createCmd.Flags().StringVarP(&opts.DataFilesStr, "datafile", "d", "", `Colon separated files containing data objects.
+'-' reads stdin and http(s) URLs are downloaded.
+They are merged in the order listed, see --merge`)
+	addDataFlags(createCmd, &opts)
+	addTmplFlags(createCmd, &opts)
+	addFuncFlags(createCmd, &opts)
 	return createCmd
 }
 
@@ -50,9 +52,21 @@ func ensure(opts *tpl.TmplOpts) error {
 	if err != nil {
 		return err
 	}
+	// report both the schema errors and the missing keys
+	errs := []string{}
+	err = tmpl.Validate()
+	if err != nil {
+		errs = append(errs, err.Error())
+	}
 	err = tmpl.EnsureFiles()
 	if err != nil {
-		return err
+		errs = append(errs, err.Error())
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "\n"))
+	}
+	if tmpl.Schema != nil {
+		fmt.Printf("%s\n", "the data matches the schema")
 	}
 	fmt.Printf("%s\n", "there is no missing key")
 	return nil
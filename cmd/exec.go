@@ -24,9 +24,12 @@ import (
 func newExecCommand() *cobra.Command {
 	var opts tpl.TmplOpts
 	createCmd := &cobra.Command{
-		Use:   "exec [OPTIONS] TMPL_FILE [TMPL_FILE...]",
+		Use:   "exec [OPTIONS] TMPL_FILE|TMPL_DIR [TMPL_FILE|TMPL_DIR...]",
 		Short: "Execute Go templates",
-		//Long:  `Execute Go templates"`,
+		Long: `Execute Go templates.
+If a directory is given, its '*.tpl' and '*.tmpl' files are executed and
+the other files are copied into the 'outdir' flag with the same tree.
+Templates starting with '_' are used as partial templates`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			err := RequiresMinArgs(cmd, args, 1)
 			if err != nil {
@@ -36,19 +39,36 @@ func newExecCommand() *cobra.Command {
 			return exec(&opts)
 		},
 	}
-	createCmd.Flags().StringVarP(&opts.DataFilesStr, "datafile", "d", "", "Colon separated files containing data objects")
-	createCmd.Flags().BoolVarP(&opts.UseEnv, "env", "e", false, "Load the environment variables into the data objects")
-	createCmd.Flags().StringVarP(&opts.UseEnvFromPrefix, "env-prefix", "p", "", `Key prefix to load environment variables.
-If a template key has a dot chain of the given value as a prefix,
-load the corresponding environment variable into the data objects`)
+	createCmd.Flags().BoolVarP(&opts.Atomic, "atomic", "", false, `Store the processed templates only if all of them are stored,
+rolling back the files already stored on failure.
+Files whose overwrite is declined are skipped`)
+	createCmd.Flags().StringVarP(&opts.DataFilesStr, "datafile", "d", "", `Colon separated files containing data objects.
+'-' reads stdin and http(s) URLs are downloaded.
+They are merged in the order listed, see --merge`)
+	addDataFlags(createCmd, &opts)
+	createCmd.Flags().BoolVarP(&opts.DryRun, "dry-run", "n", false, `Do not store the processed templates, but print the unified diff
+against the files of the 'out' or 'outdir' flag.
+Exit status is 0 if no file changes, 2 if any file changes and 1 on error`)
 	createCmd.Flags().StringVarP(&opts.DataOutFile, "export-data", "x", "", `Output file to store the data. Omit to do not store data.
-The data also contains the values obtained in interactive mode`)
+The data also contains the values obtained in interactive mode.
+Not stored with the 'dry-run' flag`)
 	createCmd.Flags().BoolVarP(&opts.FoldContext, "fold-context", "c", false, `Folds the parent context of missing keys when searching.
 Only meaningful if the template file is yaml|json format`)
-	createCmd.Flags().StringVarP(&opts.DataFormat, "format", "f", "yaml", "Default format for input data file without extention")
-	createCmd.Flags().BoolVarP(&opts.Interactive, "interactive", "i", false, `Search for missing keys and input values from the stdin.
-(Do not support template files including 'Actions' or 'Fuctions')`)
+	addTmplFlags(createCmd, &opts)
+	addFuncFlags(createCmd, &opts)
+	createCmd.Flags().BoolVarP(&opts.Interactive, "interactive", "i", false, `Search the parse tree for missing keys and input values from the stdin.
+The prompts show the defaults and the types, and '<' goes back to the previous key`)
+	createCmd.Flags().BoolVarP(&opts.Form, "form", "", false, `Fill every missing key at once in a kv file opened with $VISUAL or $EDITOR.
+Secret keys are asked afterwards without echo. Implies --interactive`)
+	createCmd.Flags().StringVarP(&opts.Answers, "answers", "", "", `File of the answers of earlier interactive sessions, like 'answers.yml'.
+The answered keys are not asked again, and the new answers are saved to the file,
+except the values of secret keys. Implies --interactive`)
+	createCmd.Flags().BoolVarP(&opts.NoTTY, "no-tty", "", false, `Never read answers from stdin: use the defaults of the missing keys,
+and fail listing every key without a value or a default.
+Implies --interactive`)
 	createCmd.Flags().StringVarP(&opts.MissingKey, "missingkey", "m", "error", "The missingkey gotemplate option")
+	createCmd.Flags().StringVarP(&opts.ModeStr, "mode", "", "", `Octal mode of the stored files like '0644'. Omit to use the mode of the source file.
+A template can set its own mode with the front matter '{{/* tpl mode: 0600 */}}'`)
 	createCmd.Flags().StringVarP(&opts.Output, "out", "o", "", `Output file to store processed templates. Omit to use stdout,
 but if 'outdir' flag is specified, output will not be stdout`)
 	createCmd.Flags().StringVarP(&opts.OutDir, "outdir", "", "", `Directory to store the processed templates.
@@ -68,7 +88,24 @@ func exec(opts *tpl.TmplOpts) error {
 	if err != nil {
 		return fmt.Errorf("failed to execute templates: %v", err)
 	}
-	tmpl.FillDestPath("")
+	err = tmpl.FillDestPath("")
+	if err != nil {
+		return err
+	}
+	err = tmpl.CheckDestFiles()
+	if err != nil {
+		return fmt.Errorf("failed to read destination files: %v", err)
+	}
+	if opts.DryRun {
+		changed, err := tmpl.PrintDiff()
+		if err != nil {
+			return err
+		}
+		if changed {
+			return &exitCodeError{code: exitCodeChanges}
+		}
+		return nil
+	}
 	err = tmpl.WriteProcessedTmpl()
 	if err != nil {
 		return fmt.Errorf("failed to write processed templates: %v", err)
@@ -0,0 +1,80 @@
+// Copyright © 2018 byung2
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"strings"
+
+	"github.com/byung2/tpl"
+	"github.com/spf13/cobra"
+)
+
+// addDataFlags adds the flags of the environment variables, the values set on the command line,
+// the types and the schema of the data object
+func addDataFlags(cmd *cobra.Command, opts *tpl.TmplOpts) {
+	cmd.Flags().BoolVarP(&opts.UseEnv, "env", "e", false, "Load the environment variables into the data objects")
+	cmd.Flags().StringVarP(&opts.UseEnvFromPrefix, "env-prefix", "p", "", `Key prefix to load environment variables.
+If a template key has a dot chain of the given value as a prefix,
+load the corresponding environment variable into the data objects`)
+	cmd.Flags().StringVarP(&opts.EnvSeparator, "env-separator", "", "", `Separator of the key segments in the names of environment variables,
+like '__' to load 'DB__HOST' as 'db.host' or '_' for 'DB_HOST'.
+List indexes are numbers like 'SERVERS__0__HOST'. Omit to use '.'`)
+	cmd.Flags().StringVarP(&opts.EnvCase, "env-case", "", "", `Case of the names of environment variables: exact, upper or ignore.
+Omit to use exact`)
+	cmd.Flags().StringVarP(&opts.EnvStripPrefix, "env-strip-prefix", "", "", `Prefix of the names of environment variables like 'APP_'.
+Only the variables with the prefix are loaded, without the prefix`)
+	cmd.Flags().StringVarP(&opts.EnvPrecedence, "env-precedence", "", "", `Precedence of environment variables over data files:
+gaps (set the keys without values or with null values),
+file (set the keys the data files do not have)
+or env (override the values of the data files). Omit to use gaps`)
+	cmd.Flags().StringVarP(&opts.DataFormat, "format", "f", "", "Default format for input data file without extention.\nOne of "+strings.Join(tpl.FormatNames(), ", ")+".\nOmit to use yaml, or to detect the format of the data from stdin")
+	cmd.Flags().StringArrayVarP(&opts.SetValues, "set", "", nil, `Set the value of a dot separated key like 'a.b=c' on top of the other data.
+Integers, 'true', 'false', 'null' and '{a,b}' lists are typed,
+and a type hint like 'replicas:int=3' sets the type.
+Separate multiple values with commas or repeat the flag`)
+	cmd.Flags().StringArrayVarP(&opts.SetStringValues, "set-string", "", nil, "Same as --set, but the values are always strings")
+	cmd.Flags().StringArrayVarP(&opts.SetFileValues, "set-file", "", nil, "Same as --set, but the values are read from the files like 'key=path'")
+	cmd.Flags().BoolVarP(&opts.InferTypes, "infer-types", "", false, `Convert the string values of kv, dotenv, ini and properties data files,
+environment variables and interactive input to bools, numbers,
+null, or json objects and lists`)
+	cmd.Flags().StringArrayVarP(&opts.Types, "type", "", nil, `Type of a dot separated key like 'replicas=int'. The string values
+of the key, including interactive input, are converted to the type.
+One of `+strings.Join(tpl.ValueTypes, ", ")+`.
+Separate multiple types with commas or repeat the flag`)
+	cmd.Flags().StringVarP(&opts.Schema, "schema", "", "", `JSON Schema file, in JSON or YAML, to validate the data object.
+Its defaults are set for the missing keys and its types are used like --type.
+Omit to use 'values.schema.json' next to the templates if found`)
+	cmd.Flags().StringVarP(&opts.Merge, "merge", "", "", `Strategy to merge multiple data files:
+override, keep-first, deep-append-lists or error-on-conflict.
+Omit to use override`)
+}
+
+// addTmplFlags adds the flags of the files used in template directories and the partial templates
+func addTmplFlags(cmd *cobra.Command, opts *tpl.TmplOpts) {
+	cmd.Flags().StringVarP(&opts.ExcludeStr, "exclude", "", "", `Colon separated globs of files to skip in template directories.
+The globs of '.tplignore' in a template directory are also used`)
+	cmd.Flags().StringVarP(&opts.MatchStr, "match", "", "", `Colon separated globs of files to use in template directories.
+Omit to use all files`)
+	cmd.Flags().StringVarP(&opts.IncludesStr, "include", "I", "", `Colon separated files or globs of partial templates,
+or directories to include their '_*' files.
+Their 'define' templates can be called from every template`)
+}
+
+// addFuncFlags adds the flags of the template functions reading files and running commands
+func addFuncFlags(cmd *cobra.Command, opts *tpl.TmplOpts) {
+	cmd.Flags().BoolVarP(&opts.AllowExec, "allow-exec", "", false, "Allow the 'exec' function to run commands")
+	cmd.Flags().StringVarP(&opts.FileRoot, "file-root", "", "", `Directory the 'file', 'readYaml' and 'readJson' functions can read from.
+Relative paths are relative to it. Omit to use the current directory`)
+}
@@ -16,6 +16,7 @@ package cmd
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/byung2/tpl"
 	"github.com/spf13/cobra"
@@ -24,10 +25,11 @@ import (
 func newKeysCommand() *cobra.Command {
 	var opts tpl.TmplOpts
 	createCmd := &cobra.Command{
-		Use:   "keys [OPTIONS] TMPL_FILE [TMPL_FILE...]",
+		Use:   "keys [OPTIONS] TMPL_FILE|TMPL_DIR [TMPL_FILE|TMPL_DIR...]",
 		Short: "Show all missing keys and processed key:value pairs",
 		Long: `Show all missing keys and processed key:value pairs.
-(Do not support template files including 'Actions' or 'Fuctions')`,
+Keys referenced in 'Actions' and 'Functions' are also found by walking
+the parse tree, following the dot set by 'with' and 'range'`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			err := RequiresMinArgs(cmd, args, 1)
 			if err != nil {
@@ -39,13 +41,14 @@ func newKeysCommand() *cobra.Command {
 	}
 	createCmd.Flags().StringVarP(&opts.DataFilesStr, "datafile", "d", "", `Colon separated files containing data objects
 to execute templates to retrieve processed key:value pairs.
+'-' reads stdin and http(s) URLs are downloaded.
+They are merged in the order listed, see --merge.
 Omit to get only the keys of unprocessed TMPL FILES`)
-	createCmd.Flags().BoolVarP(&opts.UseEnv, "env", "e", false, "Load the environment variables into the data objects")
-	createCmd.Flags().StringVarP(&opts.UseEnvFromPrefix, "env-prefix", "p", "", `Key prefix to load environment variables.
-If a template key has a dot chain of the given value as a prefix,
-load the corresponding environment variable into the data objects`)
-	createCmd.Flags().StringVarP(&opts.DataFormat, "format", "f", "yaml", "Default format for input data file without extention")
-	createCmd.Flags().StringVarP(&opts.DataOutFormat, "output-format", "t", "yaml", "Output format for data object")
+	addDataFlags(createCmd, &opts)
+	addTmplFlags(createCmd, &opts)
+	createCmd.Flags().BoolVarP(&opts.Deps, "deps", "", false, `Show the environment variables, files and commands the templates
+depend on through the 'env', 'file', 'readYaml', 'readJson' and 'exec' functions`)
+	createCmd.Flags().StringVarP(&opts.DataOutFormat, "output-format", "t", "yaml", "Output format for data object. Keys are sorted in every format.\nOne of "+strings.Join(tpl.FormatNames(), ", ")+", or schema for a starter JSON Schema")
 	createCmd.Flags().BoolVarP(&opts.ShowOnlyMissingKey, "missing", "m", false, `Show only missing keys of processed template.
 Only used for --datafile is specified`)
 	createCmd.Flags().StringVarP(&opts.DataOutFile, "out", "o", "", "Output file to store the generated data. Omit to use stdout")
@@ -57,6 +60,14 @@ func keys(opts *tpl.TmplOpts) error {
 	if err != nil {
 		return err
 	}
+	if opts.Deps {
+		report, err := tmpl.DepsReport()
+		if err != nil {
+			return fmt.Errorf("failed to find dependencies: %v", err)
+		}
+		tmpl.WriteDataObject(report)
+		return nil
+	}
 	keys, err := tmpl.ExtractKeys()
 	if err != nil {
 		return fmt.Errorf("failed to export keys: %v", err)
@@ -47,11 +47,26 @@ var rootCmd = &cobra.Command{
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
+		if e, ok := err.(*exitCodeError); ok {
+			os.Exit(e.code)
+		}
 		fmt.Println(err)
 		os.Exit(1)
 	}
 }
 
+// exitCodeChanges is the exit status of a dry-run that changes files
+const exitCodeChanges = 2
+
+// exitCodeError makes Execute exit with the code without printing an error
+type exitCodeError struct {
+	code int
+}
+
+func (e *exitCodeError) Error() string {
+	return fmt.Sprintf("exit status %d", e.code)
+}
+
 func init() {
 	cobra.OnInitialize(initConfig)
 
@@ -66,6 +81,7 @@ func init() {
 	rootCmd.AddCommand(newExecCommand())
 	rootCmd.AddCommand(newEnsureCommand())
 	rootCmd.AddCommand(newKeysCommand())
+	rootCmd.AddCommand(newDataCommand())
 	rootCmd.AddCommand(newCompletionCommand())
 }
 
@@ -0,0 +1,164 @@
+package tpl
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// stdinDataFile is the data file name to read a data object from stdin
+const stdinDataFile = "-"
+
+func isURL(file string) bool {
+	return strings.HasPrefix(file, "http://") || strings.HasPrefix(file, "https://")
+}
+
+var portRe = regexp.MustCompile(`^[0-9]+(/|$)`)
+
+// splitDataFiles splits the colon separated data files,
+// keeping the colons of http(s) URLs and their ports
+func splitDataFiles(dataFilesStr string) []string {
+	if dataFilesStr == "" {
+		return nil
+	}
+	elems := strings.Split(dataFilesStr, ":")
+	files := []string{}
+	for i := 0; i < len(elems); i++ {
+		file := elems[i]
+		if (file == "http" || file == "https") && i+1 < len(elems) && strings.HasPrefix(elems[i+1], "//") {
+			i++
+			file += ":" + elems[i]
+			if i+1 < len(elems) && portRe.MatchString(elems[i+1]) {
+				i++
+				file += ":" + elems[i]
+			}
+		}
+		files = append(files, file)
+	}
+	return files
+}
+
+// httpClient downloads the data files of http(s) URLs
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// readDataSource reads the data file or the body of a http(s) URL
+func readDataSource(file string) ([]byte, error) {
+	if isURL(file) {
+		resp, err := httpClient.Get(file)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("failed to get '%s': %s", file, resp.Status)
+		}
+		return ioutil.ReadAll(resp.Body)
+	}
+	return ioutil.ReadFile(file)
+}
+
+var (
+	iniSectionRe     = regexp.MustCompile(`^\[[^\[\]"]+\]$`)
+	tomlArrayTableRe = regexp.MustCompile(`^\[\[[^\[\]"]+\]\]$`)
+	hclBlockRe       = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*(\s+"[^"]*")*\s*\{$`)
+	tomlValueRe      = regexp.MustCompile(`^("|'|\[|\{)`)
+)
+
+// sniffDataFormat guesses the format of the data by its lines.
+// Sections are ini, or toml if the values are quoted. Array tables and values of arrays
+// or inline tables are toml, blocks and '//' comments are hcl, and '!' comments and
+// lines continued with '\' are properties. Other key=value lines are kv
+func sniffDataFormat(dat []byte) string {
+	section, keys, quoted := false, false, false
+	scanner := bufio.NewScanner(bytes.NewReader(dat))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		switch {
+		case line == "---":
+			return "yaml"
+		case strings.HasPrefix(line, "!"):
+			return "properties"
+		case strings.HasPrefix(line, "//") || strings.HasPrefix(line, "/*"):
+			return "hcl"
+		case tomlArrayTableRe.MatchString(line):
+			return "toml"
+		case iniSectionRe.MatchString(line):
+			section = true
+			continue
+		case !section && !keys && (strings.HasPrefix(line, "{") || strings.HasPrefix(line, "[")):
+			return "json"
+		case hclBlockRe.MatchString(line):
+			return "hcl"
+		}
+		eq := strings.Index(line, "=")
+		colon := strings.Index(line, ":")
+		if eq <= 0 || (colon >= 0 && colon < eq) {
+			// stop at a line that is not key=value such as 'key: value'
+			break
+		}
+		value := strings.TrimSpace(line[eq+1:])
+		switch {
+		case value == "{":
+			// objects span lines only in hcl
+			return "hcl"
+		case strings.HasPrefix(value, "[") || strings.HasPrefix(value, "{"):
+			return "toml"
+		case strings.HasSuffix(line, "\\"):
+			return "properties"
+		}
+		keys = true
+		quoted = quoted || tomlValueRe.MatchString(value)
+	}
+	switch {
+	case section && quoted:
+		return "toml"
+	case section:
+		return "ini"
+	case keys:
+		return "kv"
+	}
+	return "yaml"
+}
+
+// detectFormat returns the format of the data file by its extension, or the default format
+func detectFormat(file string, defaultFormat *Format) *Format {
+	if isURL(file) {
+		if u, err := url.Parse(file); err == nil {
+			file = u.Path
+		}
+	}
+	if format := LookupFormat(path.Ext(file)); format != nil && path.Ext(file) != "" {
+		return format
+	}
+	// files such as '.env' have no extension but the name
+	if format := LookupFormat(path.Base(file)); format != nil {
+		return format
+	}
+	return defaultFormat
+}
+
+// parseData parses the data of the format into a data object
+func parseData(dat []byte, format *Format, name string, infer bool) (map[string]interface{}, error) {
+	unmarshal := format.Unmarshal
+	if infer && format.UnmarshalInfer != nil {
+		unmarshal = format.UnmarshalInfer
+	}
+	kv, err := unmarshal(dat)
+	if lineErr, ok := err.(*lineError); ok {
+		return nil, fmt.Errorf("failed to parse %s data file '%s:%d': %s", format.Name, name, lineErr.line, lineErr.msg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s data file '%s': %v", format.Name, name, err)
+	}
+	return normalizeValue(kv).(map[string]interface{}), nil
+}
@@ -0,0 +1,79 @@
+package tpl
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSniffDataFormat(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"", "yaml"},
+		{"# comment\nname: web\n", "yaml"},
+		{"---\na: b=c\n", "yaml"},
+		{"url: http://x?a=b\n", "yaml"},
+		{`{"name": "web"}`, "json"},
+		{"name=web\nport=80\n", "kv"},
+		{"export NAME=\"web\"\n", "kv"},
+		{"[db]\nport = 5432\n", "ini"},
+		{"; comment\n[db]\n\nhost = localhost\n", "ini"},
+		{"[db]\n", "ini"},
+		{"[db]\nhost = \"localhost\"\n", "toml"},
+		{"title = \"x\"\n[db]\nport = 5432\n", "toml"},
+		{"title = x\n[db]\nport = 5432\n", "ini"},
+		{"ports = [1, 2]\n", "toml"},
+		{"db = { host = \"h\" }\n", "toml"},
+		{"[[servers]]\nhost = \"a\"\n", "toml"},
+		{"service \"web\" {\n  port = 80\n}\n", "hcl"},
+		{"db {\n  host = \"h\"\n}\n", "hcl"},
+		{"db = {\n  host = \"h\"\n}\n", "hcl"},
+		{"// comment\nname = \"web\"\n", "hcl"},
+		{"! comment\nname=web\n", "properties"},
+		{"motd=line one \\\n  line two\n", "properties"},
+	}
+	for _, tc := range tests {
+		got := sniffDataFormat([]byte(tc.text))
+		if got != tc.want {
+			t.Errorf("sniffDataFormat(%q) = %s, want %s", tc.text, got, tc.want)
+			continue
+		}
+		if _, err := parseSniffedData([]byte(tc.text), "", "stdin", false); err != nil {
+			t.Errorf("parseSniffedData(%q): %v", tc.text, err)
+		}
+	}
+}
+
+func TestParseSniffedDataFormat(t *testing.T) {
+	// the given format is used instead of the sniffed one
+	got, err := parseSniffedData([]byte("a=x:y\n"), "kv", "stdin", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]interface{}{"a": "x:y"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if _, err := parseSniffedData([]byte("a=x:y\n"), "yaml", "stdin", false); err == nil {
+		t.Errorf("expected error parsing key=value as yaml")
+	}
+}
+
+func TestSplitDataFiles(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"", nil},
+		{"a.yml", []string{"a.yml"}},
+		{"a.yml:b.json:-", []string{"a.yml", "b.json", "-"}},
+		{"https://example.com/a.yml:b.yml", []string{"https://example.com/a.yml", "b.yml"}},
+		{"http://localhost:8080/a.yml:b.yml", []string{"http://localhost:8080/a.yml", "b.yml"}},
+		{"http://localhost:8080", []string{"http://localhost:8080"}},
+	}
+	for _, tc := range tests {
+		if got := splitDataFiles(tc.text); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("splitDataFiles(%q) = %q, want %q", tc.text, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package tpl
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines around changes in a unified diff
+const diffContext = 3
+
+// diffOp is an edit of a line: ' ' keeps, '-' deletes and '+' inserts the line
+type diffOp struct {
+	kind byte
+	line string
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines returns the shortest edit script from a to b by the linear space
+// variant of the Myers algorithm, which splits the texts at the middle of the edit path
+func diffLines(a, b []string) []diffOp {
+	return appendDiff(make([]diffOp, 0, len(a)+len(b)), a, b)
+}
+
+func appendDiff(ops []diffOp, a, b []string) []diffOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	for _, line := range a[:prefix] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	a, b = a[prefix:], b[prefix:]
+	suffix := 0
+	for suffix < len(a) && suffix < len(b) && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	common := a[len(a)-suffix:]
+	a, b = a[:len(a)-suffix], b[:len(b)-suffix]
+	split := false
+	if len(a) > 0 && len(b) > 0 {
+		// a split at either end would not make the texts shorter
+		x, y, ok := middleSplit(a, b)
+		if split = ok && x+y > 0 && x+y < len(a)+len(b); split {
+			ops = appendDiff(ops, a[:x], b[:y])
+			ops = appendDiff(ops, a[x:], b[y:])
+		}
+	}
+	if !split {
+		for _, line := range a {
+			ops = append(ops, diffOp{'-', line})
+		}
+		for _, line := range b {
+			ops = append(ops, diffOp{'+', line})
+		}
+	}
+	for _, line := range common {
+		ops = append(ops, diffOp{' ', line})
+	}
+	return ops
+}
+
+// middleSplit runs the edit paths from both ends of a and b until they overlap,
+// and returns the point on a shortest edit path where they meet.
+// It reports false if a and b have no common line
+func middleSplit(a, b []string) (int, int, bool) {
+	n, m := len(a), len(b)
+	max := (n + m + 1) / 2
+	vf := make([]int, 2*max+2)
+	vb := make([]int, 2*max+2)
+	for i := range vf {
+		vf[i], vb[i] = -1, -1
+	}
+	vf[max+1], vb[max+1] = 0, 0
+	delta := n - m
+	// the forward path checks the overlap if delta is odd, the backward path otherwise
+	odd := delta%2 != 0
+	// diagonals trimmed as their paths go past the ends
+	fStart, fEnd, bStart, bEnd := 0, 0, 0, 0
+	for d := 0; d < max; d++ {
+		for k := -d + fStart; k <= d-fEnd; k += 2 {
+			i := max + k
+			var x int
+			if k == -d || (k != d && vf[i-1] < vf[i+1]) {
+				x = vf[i+1]
+			} else {
+				x = vf[i-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			vf[i] = x
+			switch {
+			case x > n:
+				fEnd += 2
+			case y > m:
+				fStart += 2
+			case odd:
+				j := max + delta - k
+				if j >= 0 && j < len(vb) && vb[j] != -1 && x >= n-vb[j] {
+					return x, y, true
+				}
+			}
+		}
+		for k := -d + bStart; k <= d-bEnd; k += 2 {
+			i := max + k
+			var x int
+			if k == -d || (k != d && vb[i-1] < vb[i+1]) {
+				x = vb[i+1]
+			} else {
+				x = vb[i-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[n-x-1] == b[m-y-1] {
+				x++
+				y++
+			}
+			vb[i] = x
+			switch {
+			case x > n:
+				bEnd += 2
+			case y > m:
+				bStart += 2
+			case !odd:
+				j := max + delta - k
+				if j >= 0 && j < len(vf) && vf[j] != -1 && vf[j] >= n-x {
+					return vf[j], vf[j] - (j - max), true
+				}
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// UnifiedDiff returns the unified diff from the text a to the text b,
+// or an empty string if they are the same
+func UnifiedDiff(fromFile, toFile string, a, b string) string {
+	if a == b {
+		return ""
+	}
+	ops := diffLines(splitLines(a), splitLines(b))
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "--- %s\n+++ %s\n", fromFile, toFile)
+	for i := 0; i < len(ops); {
+		// find the next change
+		for i < len(ops) && ops[i].kind == ' ' {
+			i++
+		}
+		if i == len(ops) {
+			break
+		}
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+		// extend the hunk while changes are close to each other
+		end := i
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			next := end
+			for next < len(ops) && ops[next].kind == ' ' {
+				next++
+			}
+			if next == len(ops) || next-end > 2*diffContext {
+				end += diffContext
+				if end > len(ops) {
+					end = len(ops)
+				}
+				break
+			}
+			end = next
+		}
+		writeHunk(buf, ops, start, end)
+		i = end
+	}
+	return buf.String()
+}
+
+func writeHunk(buf *bytes.Buffer, ops []diffOp, start, end int) {
+	aStart, bStart := 1, 1
+	for _, op := range ops[:start] {
+		if op.kind != '+' {
+			aStart++
+		}
+		if op.kind != '-' {
+			bStart++
+		}
+	}
+	aLen, bLen := 0, 0
+	for _, op := range ops[start:end] {
+		if op.kind != '+' {
+			aLen++
+		}
+		if op.kind != '-' {
+			bLen++
+		}
+	}
+	if aLen == 0 {
+		aStart--
+	}
+	if bLen == 0 {
+		bStart--
+	}
+	fmt.Fprintf(buf, "@@ -%s +%s @@\n", hunkRange(aStart, aLen), hunkRange(bStart, bLen))
+	for _, op := range ops[start:end] {
+		buf.WriteByte(op.kind)
+		buf.WriteString(op.line)
+		if !strings.HasSuffix(op.line, "\n") {
+			buf.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+func hunkRange(start, length int) string {
+	if length == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, length)
+}
@@ -0,0 +1,155 @@
+package tpl
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// lcsLen is the length of the longest common subsequence of a and b
+func lcsLen(a, b []string) int {
+	dp := make([][]int, len(a)+1)
+	for i := range dp {
+		dp[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				dp[i][j] = dp[i+1][j+1] + 1
+			case dp[i+1][j] > dp[i][j+1]:
+				dp[i][j] = dp[i+1][j]
+			default:
+				dp[i][j] = dp[i][j+1]
+			}
+		}
+	}
+	return dp[0][0]
+}
+
+func TestDiffLines(t *testing.T) {
+	tests := [][2]string{
+		{"", ""},
+		{"", "a\nb\n"},
+		{"a\nb\n", ""},
+		{"a\nb\nc\n", "a\nb\nc\n"},
+		{"a\nb\nc\n", "a\nx\nc\n"},
+		{"a\nb\nc\na\nb\nb\na\n", "c\nb\na\nb\na\nc\n"},
+		{"a\nb\nc\nd\ne\nf\n", "b\nc\nx\ne\nf\ng\n"},
+		{"x\n", "y"},
+	}
+	// random texts of few distinct lines have many common subsequences
+	r := rand.New(rand.NewSource(1))
+	random := func() string {
+		s := ""
+		for i := r.Intn(12); i > 0; i-- {
+			s += string(rune('a'+r.Intn(4))) + "\n"
+		}
+		return s
+	}
+	for i := 0; i < 500; i++ {
+		tests = append(tests, [2]string{random(), random()})
+	}
+	for _, tc := range tests {
+		a, b := splitLines(tc[0]), splitLines(tc[1])
+		ops := diffLines(a, b)
+		from, to := []string{}, []string{}
+		edits := 0
+		for _, op := range ops {
+			if op.kind != '+' {
+				from = append(from, op.line)
+			}
+			if op.kind != '-' {
+				to = append(to, op.line)
+			}
+			if op.kind != ' ' {
+				edits++
+			}
+		}
+		if strings.Join(from, "") != tc[0] || strings.Join(to, "") != tc[1] {
+			t.Errorf("diffLines(%q, %q) does not reproduce the texts: %v", tc[0], tc[1], ops)
+		}
+		if want := len(a) + len(b) - 2*lcsLen(a, b); edits != want {
+			t.Errorf("diffLines(%q, %q) has %d edits, want %d", tc[0], tc[1], edits, want)
+		}
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	lines := func(from, to int) string {
+		s := ""
+		for i := from; i <= to; i++ {
+			s += string(rune('a'+i-1)) + "\n"
+		}
+		return s
+	}
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{"same", "a\n", "a\n", ""},
+		{"new file", "", "a\nb\n", "--- a\n+++ b\n@@ -0,0 +1,2 @@\n+a\n+b\n"},
+		{"removed file", "a\n", "", "--- a\n+++ b\n@@ -1 +0,0 @@\n-a\n"},
+		{"change", "a\nb\nc\n", "a\nx\nc\n", "--- a\n+++ b\n@@ -1,3 +1,3 @@\n a\n-b\n+x\n c\n"},
+		{"no newline", "a\n", "a", "--- a\n+++ b\n@@ -1 +1 @@\n-a\n+a\n\\ No newline at end of file\n"},
+		{
+			"context",
+			lines(1, 10),
+			strings.Replace(lines(1, 10), "e\n", "E\n", 1),
+			"--- a\n+++ b\n@@ -2,7 +2,7 @@\n b\n c\n d\n-e\n+E\n f\n g\n h\n",
+		},
+		{
+			"separate hunks",
+			lines(1, 20),
+			strings.Replace(strings.Replace(lines(1, 20), "b\n", "B\n", 1), "s\n", "S\n", 1),
+			"--- a\n+++ b\n@@ -1,5 +1,5 @@\n a\n-b\n+B\n c\n d\n e\n@@ -16,5 +16,5 @@\n p\n q\n r\n-s\n+S\n t\n",
+		},
+		{
+			"joined hunks",
+			lines(1, 12),
+			strings.Replace(strings.Replace(lines(1, 12), "c\n", "C\n", 1), "i\n", "I\n", 1),
+			"--- a\n+++ b\n@@ -1,12 +1,12 @@\n a\n b\n-c\n+C\n d\n e\n f\n g\n h\n-i\n+I\n j\n k\n l\n",
+		},
+	}
+	for _, tc := range tests {
+		if got := UnifiedDiff("a", "b", tc.a, tc.b); got != tc.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestDiffLinesLarge(t *testing.T) {
+	n := 8000
+	a := make([]string, n)
+	b := make([]string, n)
+	changed := make([]string, n)
+	for i := range a {
+		a[i] = fmt.Sprintf("a%d\n", i)
+		b[i] = fmt.Sprintf("b%d\n", i)
+		changed[i] = a[i]
+		if i%500 == 0 {
+			changed[i] = fmt.Sprintf("c%d\n", i)
+		}
+	}
+	// the memory does not grow with the number of edits
+	edits := 0
+	for _, op := range diffLines(a, b) {
+		if op.kind != ' ' {
+			edits++
+		}
+	}
+	if edits != 2*n {
+		t.Errorf("replacing every line has %d edits, want %d", edits, 2*n)
+	}
+	edits = 0
+	for _, op := range diffLines(a, changed) {
+		if op.kind != ' ' {
+			edits++
+		}
+	}
+	if want := 2 * n / 500; edits != want {
+		t.Errorf("changing every 500th line has %d edits, want %d", edits, want)
+	}
+}
@@ -0,0 +1,149 @@
+package tpl
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Cases of the names of environment variables
+const (
+	// EnvCaseExact matches the names with the keys as they are
+	EnvCaseExact = "exact"
+	// EnvCaseUpper matches the names with the keys in upper case like 'DB_HOST'
+	EnvCaseUpper = "upper"
+	// EnvCaseIgnore matches the names with the keys in any case
+	EnvCaseIgnore = "ignore"
+)
+
+// EnvCases are the names accepted by the env-case option
+var EnvCases = []string{EnvCaseExact, EnvCaseUpper, EnvCaseIgnore}
+
+// Precedences of environment variables over the values of data files
+const (
+	// EnvPrecedenceGaps sets the keys without values or with null values
+	EnvPrecedenceGaps = "gaps"
+	// EnvPrecedenceFile sets the keys the data files do not have
+	EnvPrecedenceFile = "file"
+	// EnvPrecedenceEnv overrides the values of the data files
+	EnvPrecedenceEnv = "env"
+)
+
+// EnvPrecedences are the names accepted by the env-precedence option
+var EnvPrecedences = []string{EnvPrecedenceGaps, EnvPrecedenceFile, EnvPrecedenceEnv}
+
+func validEnvCase(c string) bool {
+	for _, x := range EnvCases {
+		if x == c {
+			return true
+		}
+	}
+	return false
+}
+
+func validEnvPrecedence(p string) bool {
+	for _, x := range EnvPrecedences {
+		if x == p {
+			return true
+		}
+	}
+	return false
+}
+
+// envMatcher matches the names of environment variables to a template key
+// whose list indexes are taken from the name
+type envMatcher struct {
+	elems []string
+	re    *regexp.Regexp
+}
+
+// envMatchers returns the matchers of the template keys under the key prefix.
+// The segments of a key are joined with the separator in the name, and list indexes
+// are written like '[0]' with the separator '.', or as numbers with the other separators
+func (s *EnvSource) envMatchers(keys map[string]bool, prefix string) []*envMatcher {
+	sep := s.Separator
+	if sep == "" {
+		sep = "."
+	}
+	sorted := []string{}
+	for key := range keys {
+		if prefix == "" || isParentKey(firstIndexKey(prefix), key) {
+			sorted = append(sorted, key)
+		}
+	}
+	sort.Strings(sorted)
+	matchers := []*envMatcher{}
+	for _, key := range sorted {
+		elems := splitKey(strings.TrimPrefix(key, firstIndexKey(prefix)))
+		buf := new(bytes.Buffer)
+		if s.Case == EnvCaseIgnore {
+			buf.WriteString("(?i)")
+		}
+		buf.WriteString("^")
+		for i, elem := range elems {
+			if _, ok := keyIndex(elem); ok {
+				if sep == "." {
+					buf.WriteString(`\[([0-9]+)\]`)
+				} else {
+					if i > 0 {
+						buf.WriteString(regexp.QuoteMeta(sep))
+					}
+					buf.WriteString("([0-9]+)")
+				}
+				continue
+			}
+			if i > 0 {
+				buf.WriteString(regexp.QuoteMeta(sep))
+			}
+			if s.Case == EnvCaseUpper {
+				elem = strings.ToUpper(elem)
+			}
+			buf.WriteString(regexp.QuoteMeta(elem))
+		}
+		buf.WriteString("$")
+		re, err := regexp.Compile(buf.String())
+		if err != nil {
+			continue
+		}
+		matchers = append(matchers, &envMatcher{elems: elems, re: re})
+	}
+	return matchers
+}
+
+// envKey returns the key of the name of the environment variable under the key prefix
+func (s *EnvSource) envKey(name string, prefix string, matchers []*envMatcher) (string, bool) {
+	if s.StripPrefix != "" {
+		n := len(s.StripPrefix)
+		if len(name) <= n {
+			return "", false
+		}
+		if s.Case == EnvCaseExact || s.Case == "" {
+			if name[:n] != s.StripPrefix {
+				return "", false
+			}
+		} else if !strings.EqualFold(name[:n], s.StripPrefix) {
+			return "", false
+		}
+		name = name[n:]
+	}
+	for _, m := range matchers {
+		sub := m.re.FindStringSubmatch(name)
+		if sub == nil {
+			continue
+		}
+		key := prefix
+		sub = sub[1:]
+		for _, elem := range m.elems {
+			if _, ok := keyIndex(elem); ok {
+				key += fmt.Sprintf("[%s]", sub[0])
+				sub = sub[1:]
+				continue
+			}
+			key += "." + elem
+		}
+		return key, true
+	}
+	return "", false
+}
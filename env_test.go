@@ -0,0 +1,80 @@
+package tpl
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestEnvKey(t *testing.T) {
+	keys := map[string]bool{".name": true, ".db.host": true, ".servers[0].port": true, ".app.redis.url": true}
+	tests := []struct {
+		name   string
+		source EnvSource
+		prefix string
+		env    string
+		want   string
+	}{
+		{"exact", EnvSource{}, "", "name", ".name"},
+		{"exact dots", EnvSource{}, "", "db.host", ".db.host"},
+		{"exact index", EnvSource{}, "", "servers[2].port", ".servers[2].port"},
+		{"exact case", EnvSource{}, "", "NAME", ""},
+		{"separator", EnvSource{Separator: "__", Case: EnvCaseUpper}, "", "DB__HOST", ".db.host"},
+		{"separator index", EnvSource{Separator: "__", Case: EnvCaseUpper}, "", "SERVERS__1__PORT", ".servers[1].port"},
+		{"separator lower", EnvSource{Separator: "__", Case: EnvCaseUpper}, "", "db__host", ""},
+		{"ignore case", EnvSource{Separator: "_", Case: EnvCaseIgnore}, "", "Db_Host", ".db.host"},
+		{"strip prefix", EnvSource{Separator: "_", Case: EnvCaseUpper, StripPrefix: "APP_"}, "", "APP_DB_HOST", ".db.host"},
+		{"strip prefix missing", EnvSource{Separator: "_", Case: EnvCaseUpper, StripPrefix: "APP_"}, "", "DB_HOST", ""},
+		{"strip prefix case", EnvSource{Separator: "_", Case: EnvCaseIgnore, StripPrefix: "APP_"}, "", "app_db_host", ".db.host"},
+		{"strip prefix exact case", EnvSource{Separator: "_", StripPrefix: "APP_"}, "", "app_db_host", ""},
+		{"strip prefix only", EnvSource{StripPrefix: "APP_"}, "", "APP_", ""},
+		{"key prefix", EnvSource{Separator: "_", Case: EnvCaseUpper}, ".app.redis", "URL", ".app.redis.url"},
+		{"key prefix outside", EnvSource{Separator: "_", Case: EnvCaseUpper}, ".app.redis", "NAME", ""},
+	}
+	for _, tc := range tests {
+		s := tc.source
+		key, ok := s.envKey(tc.env, tc.prefix, s.envMatchers(keys, tc.prefix))
+		if ok != (tc.want != "") || key != tc.want {
+			t.Errorf("%s: envKey(%q) = %q, %v, want %q", tc.name, tc.env, key, ok, tc.want)
+		}
+	}
+}
+
+func TestEnvSourcePrecedence(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "a.tmpl")
+	if err := ioutil.WriteFile(file, []byte("{{ .a }}{{ .b }}{{ .c }}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for name, value := range map[string]string{"TPLTEST_A": "env", "TPLTEST_B": "env", "TPLTEST_C": "env"} {
+		os.Setenv(name, value)
+		defer os.Unsetenv(name)
+	}
+	tests := []struct {
+		precedence string
+		want       map[string]interface{}
+	}{
+		{"", map[string]interface{}{"a": "file", "b": "env", "c": "env"}},
+		{EnvPrecedenceGaps, map[string]interface{}{"a": "file", "b": "env", "c": "env"}},
+		{EnvPrecedenceFile, map[string]interface{}{"a": "file", "b": nil, "c": "env"}},
+		{EnvPrecedenceEnv, map[string]interface{}{"a": "env", "b": "env", "c": "env"}},
+	}
+	for _, tc := range tests {
+		tmpl, err := NewTmpl(&TmplOpts{TmplFiles: []string{file}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tmpl.AddSource(&MapSource{Label: "file", Data: map[string]interface{}{"a": "file", "b": nil}})
+		tmpl.AddSource(&EnvSource{Precedence: tc.precedence, Case: EnvCaseUpper, StripPrefix: "TPLTEST_"})
+		if err := tmpl.LoadData(); err != nil {
+			t.Errorf("%s: %v", tc.precedence, err)
+			continue
+		}
+		if !reflect.DeepEqual(tmpl.Data, tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.precedence, tmpl.Data, tc.want)
+		}
+	}
+}
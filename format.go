@@ -0,0 +1,320 @@
+package tpl
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/magiconair/properties"
+	toml "github.com/pelletier/go-toml"
+	ini "github.com/vaughan0/go-ini"
+	"gopkg.in/yaml.v2"
+)
+
+// Format reads and writes data objects of a file format
+type Format struct {
+	// Name is used by the format options and as a file extension
+	Name string
+	// Exts are the other file extensions of the format
+	Exts []string
+	// Unmarshal parses the data into a data object
+	Unmarshal func(dat []byte) (map[string]interface{}, error)
+	// UnmarshalInfer parses the data inferring the types of the string values,
+	// used with the infer-types option. Nil for the formats with typed values
+	UnmarshalInfer func(dat []byte) (map[string]interface{}, error)
+	// Marshal writes the data object
+	Marshal func(data map[string]interface{}) (string, error)
+}
+
+var formats = []*Format{}
+
+// RegisterFormat adds the format of data files, replacing the format of the same name
+func RegisterFormat(format *Format) {
+	for i, f := range formats {
+		if f.Name == format.Name {
+			formats[i] = format
+			return
+		}
+	}
+	formats = append(formats, format)
+}
+
+// LookupFormat returns the format of the name or the file extension, or nil if not found
+func LookupFormat(name string) *Format {
+	name = strings.ToLower(strings.TrimPrefix(name, "."))
+	for _, f := range formats {
+		if f.Name == name {
+			return f
+		}
+		for _, ext := range f.Exts {
+			if ext == name {
+				return f
+			}
+		}
+	}
+	return nil
+}
+
+// FormatNames returns the names of the registered formats
+func FormatNames() []string {
+	names := make([]string, 0, len(formats))
+	for _, f := range formats {
+		names = append(names, f.Name)
+	}
+	return names
+}
+
+func init() {
+	RegisterFormat(&Format{Name: "yaml", Exts: []string{"yml"}, Unmarshal: unmarshalYaml, Marshal: marshalYaml})
+	RegisterFormat(&Format{Name: "json", Unmarshal: unmarshalJSON, Marshal: marshalJSON})
+	RegisterFormat(&Format{Name: "ini", Unmarshal: unmarshalIni, UnmarshalInfer: inferring(unmarshalIni), Marshal: marshalIni})
+	RegisterFormat(&Format{Name: "kv", Unmarshal: unmarshalKv, UnmarshalInfer: unmarshalKvInfer, Marshal: marshalKv})
+	RegisterFormat(&Format{Name: "toml", Unmarshal: unmarshalToml, Marshal: marshalToml})
+	RegisterFormat(&Format{Name: "dotenv", Exts: []string{"env"}, Unmarshal: unmarshalDotenv, UnmarshalInfer: unmarshalDotenvInfer, Marshal: marshalDotenv})
+	RegisterFormat(&Format{Name: "properties", Exts: []string{"props"}, Unmarshal: unmarshalProperties, UnmarshalInfer: inferring(unmarshalProperties), Marshal: marshalProperties})
+	RegisterFormat(&Format{Name: "hcl", Exts: []string{"tfvars"}, Unmarshal: unmarshalHCL, Marshal: marshalHCL})
+	RegisterFormat(&Format{Name: "hcl1", Unmarshal: unmarshalHCL1, Marshal: marshalHCL1})
+}
+
+// flattenData returns the flattened keys of the data object in sorted order
+func flattenData(data map[string]interface{}) ([]string, map[string]interface{}) {
+	dataFlattenMap := make(map[string]interface{})
+	nestedToFlattenMap(data, dataFlattenMap, "", false)
+	keys := make([]string, 0, len(dataFlattenMap))
+	for key := range dataFlattenMap {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, dataFlattenMap
+}
+
+// scalarString formats a flattened value for the formats without null
+func scalarString(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return ""
+	case map[string]interface{}, []interface{}:
+		// empty objects and lists are kept as json
+		dd, err := json.Marshal(value)
+		if err == nil {
+			return string(dd)
+		}
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// inferring returns the unmarshal function inferring the types of the string values
+func inferring(unmarshal func(dat []byte) (map[string]interface{}, error)) func(dat []byte) (map[string]interface{}, error) {
+	return func(dat []byte) (map[string]interface{}, error) {
+		kv, err := unmarshal(dat)
+		if err != nil {
+			return nil, err
+		}
+		return inferTypes(normalizeValue(kv)).(map[string]interface{}), nil
+	}
+}
+
+// nullToEmpty replaces null values with empty strings for the formats without null
+func nullToEmpty(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case map[string]interface{}:
+		m := make(map[string]interface{})
+		for key, val := range v {
+			m[key] = nullToEmpty(val)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(v))
+		for i, val := range v {
+			l[i] = nullToEmpty(val)
+		}
+		return l
+	}
+	return value
+}
+
+func unmarshalYaml(dat []byte) (map[string]interface{}, error) {
+	kv := make(map[string]interface{})
+	err := yaml.Unmarshal(dat, &kv)
+	return kv, err
+}
+
+func marshalYaml(data map[string]interface{}) (string, error) {
+	dd, err := yaml.Marshal(&data)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("---\n\n%s", string(dd)), nil
+}
+
+func unmarshalJSON(dat []byte) (map[string]interface{}, error) {
+	kv := make(map[string]interface{})
+	err := json.Unmarshal(dat, &kv)
+	return kv, err
+}
+
+func marshalJSON(data map[string]interface{}) (string, error) {
+	dd, err := json.MarshalIndent(&data, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s\n", string(dd)), nil
+}
+
+// unmarshalIni parses the sections as objects. Keys with dots such as 'db.host' are nested
+func unmarshalIni(dat []byte) (map[string]interface{}, error) {
+	inifile, err := ini.Load(bytes.NewReader(dat))
+	if err != nil {
+		return nil, err
+	}
+	tmpKv := make(map[string]interface{})
+	for name, section := range inifile {
+		prefix := ""
+		if name != "" {
+			prefix = appendKeyPrefix(name)
+		}
+		for key, value := range section {
+			tmpKv[prefix+appendKeyPrefix(key)] = value
+		}
+	}
+	return expand(tmpKv), nil
+}
+
+var iniEscaper = strings.NewReplacer("\n", `\n`, "\r", `\r`)
+
+// marshalIni writes the objects of the top level as sections
+// and the keys under them as flattened keys
+func marshalIni(data map[string]interface{}) (string, error) {
+	buf := new(bytes.Buffer)
+	names := []string{}
+	for _, key := range dictKeys(data) {
+		if section, ok := data[key].(map[string]interface{}); ok && len(section) > 0 {
+			names = append(names, key)
+			continue
+		}
+		keys, flat := flattenData(map[string]interface{}{key: data[key]})
+		for _, k := range keys {
+			fmt.Fprintf(buf, "%s = %s\n", trimKeyPrefix(k), iniEscaper.Replace(scalarString(flat[k])))
+		}
+	}
+	for _, name := range names {
+		if buf.Len() > 0 {
+			buf.WriteString("\n")
+		}
+		fmt.Fprintf(buf, "[%s]\n", name)
+		keys, flat := flattenData(data[name].(map[string]interface{}))
+		for _, k := range keys {
+			fmt.Fprintf(buf, "%s = %s\n", trimKeyPrefix(k), iniEscaper.Replace(scalarString(flat[k])))
+		}
+	}
+	return buf.String(), nil
+}
+
+// unmarshalKv parses 'key=value' lines with literal values, see parseKeyValues.
+// Lines without '=' are skipped, and keys with dots such as 'db.host' are nested
+func unmarshalKv(dat []byte) (map[string]interface{}, error) {
+	return parseKeyValues(dat, kvSyntaxKv, false)
+}
+
+// unmarshalKvInfer parses 'key=value' lines inferring the types of the values without type hints
+func unmarshalKvInfer(dat []byte) (map[string]interface{}, error) {
+	return parseKeyValues(dat, kvSyntaxKv, true)
+}
+
+// unmarshalDotenv parses 'KEY=value' lines replacing the variables in the values
+func unmarshalDotenv(dat []byte) (map[string]interface{}, error) {
+	return parseKeyValues(dat, kvSyntaxDotenv, false)
+}
+
+// unmarshalDotenvInfer parses 'KEY=value' lines like unmarshalDotenv inferring the types of the values
+func unmarshalDotenvInfer(dat []byte) (map[string]interface{}, error) {
+	return parseKeyValues(dat, kvSyntaxDotenv, true)
+}
+
+var kvQuoteRe = regexp.MustCompile(`^\s|\s$|["'#\\\n\r]`)
+
+// marshalKv writes 'key=value' lines, quoting the values that would not be read back as they are
+func marshalKv(data map[string]interface{}) (string, error) {
+	keys, flat := flattenData(data)
+	buf := new(bytes.Buffer)
+	for _, key := range keys {
+		fmt.Fprintf(buf, "%s=%s\n", trimKeyPrefix(key), kvValue(scalarString(flat[key])))
+	}
+	return buf.String(), nil
+}
+
+// kvValue quotes the value of a kv line if it would not be read back as it is
+func kvValue(value string) string {
+	if kvQuoteRe.MatchString(value) {
+		return "\"" + dotenvEscaper.Replace(value) + "\""
+	}
+	return value
+}
+
+func unmarshalToml(dat []byte) (map[string]interface{}, error) {
+	tree, err := toml.LoadBytes(dat)
+	if err != nil {
+		return nil, err
+	}
+	return tree.ToMap(), nil
+}
+
+// marshalToml writes the data object as TOML. go-toml panics on arrays of mixed types,
+// which TOML does not allow
+func marshalToml(data map[string]interface{}) (out string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	tree, err := toml.TreeFromMap(nullToEmpty(data).(map[string]interface{}))
+	if err != nil {
+		return "", err
+	}
+	return tree.ToTomlString()
+}
+
+var dotenvEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`, "\n", `\n`, "\r", `\r`)
+
+func marshalDotenv(data map[string]interface{}) (string, error) {
+	keys, flat := flattenData(data)
+	buf := new(bytes.Buffer)
+	for _, key := range keys {
+		fmt.Fprintf(buf, "%s=\"%s\"\n", trimKeyPrefix(key), dotenvEscaper.Replace(scalarString(flat[key])))
+	}
+	return buf.String(), nil
+}
+
+// unmarshalProperties parses Java properties. Keys with dots such as 'db.host' are nested
+func unmarshalProperties(dat []byte) (map[string]interface{}, error) {
+	p, err := properties.Load(dat, properties.UTF8)
+	if err != nil {
+		return nil, err
+	}
+	tmpKv := make(map[string]interface{})
+	for _, key := range p.Keys() {
+		value, _ := p.Get(key)
+		tmpKv[appendKeyPrefix(key)] = value
+	}
+	return expand(tmpKv), nil
+}
+
+func marshalProperties(data map[string]interface{}) (string, error) {
+	keys, flat := flattenData(data)
+	p := properties.NewProperties()
+	p.DisableExpansion = true
+	for _, key := range keys {
+		_, _, err := p.Set(trimKeyPrefix(key), scalarString(flat[key]))
+		if err != nil {
+			return "", err
+		}
+	}
+	buf := new(bytes.Buffer)
+	_, err := p.Write(buf, properties.UTF8)
+	return buf.String(), err
+}
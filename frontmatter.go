@@ -0,0 +1,76 @@
+package tpl
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+
+	"gopkg.in/yaml.v2"
+)
+
+// FrontMatter holds options a template sets for its own output.
+// It is a yaml document in a template comment at the start of the file:
+//
+//	{{/* tpl
+//	mode: 0755
+//	*/}}
+type FrontMatter struct {
+	Mode os.FileMode
+}
+
+type frontMatterYaml struct {
+	Mode string `yaml:"mode"`
+}
+
+var (
+	frontMatterStartRe = regexp.MustCompile(`^\{\{-?\s*/\*\s*tpl\b`)
+	frontMatterRe      = regexp.MustCompile(`^\{\{-?\s*/\*\s*tpl\b((?s).*?)\*/(\s*-)?\s*\}\}(\r?\n)?`)
+)
+
+// parseFrontMatter returns the front matter and the template text.
+// The front matter may be followed by text on the same line or end the file.
+// A newline after the front matter is moved into the comment
+// so that the front matter outputs nothing and line numbers are kept
+func parseFrontMatter(text string) (*FrontMatter, string, error) {
+	if !frontMatterStartRe.MatchString(text) {
+		return nil, text, nil
+	}
+	m := frontMatterRe.FindStringSubmatchIndex(text)
+	if m == nil {
+		return nil, text, fmt.Errorf("comment is not closed with '*/}}'")
+	}
+	var fmy frontMatterYaml
+	err := yaml.Unmarshal([]byte(text[m[2]:m[3]]), &fmy)
+	if err != nil {
+		return nil, text, err
+	}
+	fm := &FrontMatter{}
+	if fmy.Mode != "" {
+		fm.Mode, err = parseFileMode(fmy.Mode)
+		if err != nil {
+			return nil, text, err
+		}
+	}
+	end := "*/}}"
+	if m[4] >= 0 {
+		end = "*/ -}}"
+	}
+	if m[6] >= 0 {
+		end = "\n" + end
+	}
+	text = text[:m[3]] + end + text[m[1]:]
+	return fm, text, nil
+}
+
+// parseFileMode parses the octal permission bits like '0644'
+func parseFileMode(s string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(s, 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid file mode '%s'", s)
+	}
+	if mode == 0 || mode > 0777 {
+		return 0, fmt.Errorf("invalid file mode '%s'", s)
+	}
+	return os.FileMode(mode), nil
+}
@@ -0,0 +1,75 @@
+package tpl
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"text/template"
+)
+
+func TestParseFrontMatter(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		mode os.FileMode
+		out  string
+	}{
+		{"none", "a={{ .a }}\n", 0, "a=1\n"},
+		{"block", "{{/* tpl\nmode: 0755\n*/}}\na={{ .a }}\n", 0755, "a=1\n"},
+		{"crlf", "{{/* tpl\r\nmode: 0755\r\n*/}}\r\na={{ .a }}\n", 0755, "a=1\n"},
+		{"same line", "{{/* tpl mode: 0600 */}}secret={{ .a }}\n", 0600, "secret=1\n"},
+		{"end of file", "{{/* tpl mode: 0600 */}}", 0600, ""},
+		{"trim markers", "{{- /* tpl\nmode: 0600\n*/ -}}\n\n  a={{ .a }}\n", 0600, "a=1\n"},
+		{"trim same line", "{{- /* tpl mode: 0600 */ -}}  a={{ .a }}\n", 0600, "a=1\n"},
+		{"not at start", "a={{ .a }}\n{{/* tpl mode: 0600 */}}\n", 0, "a=1\n\n"},
+		{"other comment", "{{/* template */}}a={{ .a }}\n", 0, "a=1\n"},
+	}
+	for _, tc := range tests {
+		fm, text, err := parseFrontMatter(tc.text)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		var mode os.FileMode
+		if fm != nil {
+			mode = fm.Mode
+		}
+		if mode != tc.mode {
+			t.Errorf("%s: got mode %o, want %o", tc.name, mode, tc.mode)
+		}
+		if bytes.Count([]byte(text), []byte("\n")) != bytes.Count([]byte(tc.text), []byte("\n")) {
+			t.Errorf("%s: line count changed in %q", tc.name, text)
+		}
+		tmpl, err := template.New(tc.name).Parse(text)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		buf := new(bytes.Buffer)
+		if err := tmpl.Execute(buf, map[string]interface{}{"a": 1}); err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if buf.String() != tc.out {
+			t.Errorf("%s: got output %q, want %q", tc.name, buf.String(), tc.out)
+		}
+	}
+}
+
+func TestParseFrontMatterErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+	}{
+		{"not closed", "{{/* tpl\nmode: 0600\n"},
+		{"not closed by template", "{{/* tpl mode: 0600 }}\n"},
+		{"yaml", "{{/* tpl\nmode: [\n*/}}\n"},
+		{"mode", "{{/* tpl mode: 0999 */}}\n"},
+		{"zero mode", "{{/* tpl mode: 0 */}}\n"},
+	}
+	for _, tc := range tests {
+		if _, _, err := parseFrontMatter(tc.text); err == nil {
+			t.Errorf("%s: expected error", tc.name)
+		}
+	}
+}
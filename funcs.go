@@ -0,0 +1,425 @@
+package tpl
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/spf13/cast"
+	"gopkg.in/yaml.v2"
+)
+
+// FuncMap returns the functions available to all templates.
+// Names and arguments follow the Sprig library used by Helm,
+// so the value comes last and can be given with a pipe.
+func FuncMap() template.FuncMap {
+	return template.FuncMap{
+		// defaults
+		"default":  defaultValue,
+		"empty":    empty,
+		"coalesce": coalesce,
+		"required": required,
+		"ternary":  ternary,
+		"fail":     fail,
+
+		// environment
+		"env": os.Getenv,
+
+		// strings
+		"upper":      strings.ToUpper,
+		"lower":      strings.ToLower,
+		"title":      strings.Title,
+		"trim":       strings.TrimSpace,
+		"trimAll":    func(cutset, s string) string { return strings.Trim(s, cutset) },
+		"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+		"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+		"replace":    func(old, new, s string) string { return strings.Replace(s, old, new, -1) },
+		"contains":   func(substr, s string) bool { return strings.Contains(s, substr) },
+		"hasPrefix":  func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+		"hasSuffix":  func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+		"repeat":     func(count int, s string) string { return strings.Repeat(s, count) },
+		"substr":     substr,
+		"trunc":      trunc,
+		"nospace":    func(s string) string { return strings.Join(strings.Fields(s), "") },
+		"quote":      quote,
+		"squote":     squote,
+		"indent":     indent,
+		"nindent":    func(spaces int, s string) string { return "\n" + indent(spaces, s) },
+		"split":      func(sep, s string) []string { return strings.Split(s, sep) },
+		"splitList":  func(sep, s string) []interface{} { return toList(strings.Split(s, sep)) },
+		"join":       join,
+		"cat":        cat,
+		"toString":   cast.ToString,
+		"regexMatch": func(re, s string) (bool, error) { return regexp.MatchString(re, s) },
+		"regexReplaceAll": func(re, s, repl string) (string, error) {
+			r, err := regexp.Compile(re)
+			if err != nil {
+				return "", err
+			}
+			return r.ReplaceAllString(s, repl), nil
+		},
+
+		// encoding
+		"b64enc":       func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) },
+		"b64dec":       b64dec,
+		"sha256sum":    sha256sum,
+		"toYaml":       toYaml,
+		"fromYaml":     fromYaml,
+		"toJson":       toJSON,
+		"toPrettyJson": toPrettyJSON,
+		"fromJson":     fromJSON,
+
+		// lists and dicts
+		"list":      func(v ...interface{}) []interface{} { return v },
+		"first":     first,
+		"last":      last,
+		"append":    func(list interface{}, v interface{}) []interface{} { return append(toList(list), v) },
+		"has":       has,
+		"uniq":      uniq,
+		"sortAlpha": sortAlpha,
+		"dict":      dict,
+		"get":       func(d interface{}, key string) interface{} { return toDict(d)[key] },
+		"set":       setKey,
+		"hasKey":    func(d interface{}, key string) bool { _, ok := toDict(d)[key]; return ok },
+		"keys":      dictKeys,
+
+		// math
+		"add":     func(a, b interface{}) int64 { return cast.ToInt64(a) + cast.ToInt64(b) },
+		"sub":     func(a, b interface{}) int64 { return cast.ToInt64(a) - cast.ToInt64(b) },
+		"mul":     func(a, b interface{}) int64 { return cast.ToInt64(a) * cast.ToInt64(b) },
+		"div":     div,
+		"mod":     mod,
+		"max":     func(a interface{}, v ...interface{}) int64 { return minMax(a, v, math.Max) },
+		"min":     func(a interface{}, v ...interface{}) int64 { return minMax(a, v, math.Min) },
+		"int":     cast.ToInt,
+		"int64":   cast.ToInt64,
+		"float64": cast.ToFloat64,
+		"atoi":    cast.ToInt,
+	}
+}
+
+// empty reports whether the value is nil or the zero value of its type
+func empty(given interface{}) bool {
+	v := reflect.ValueOf(given)
+	if !v.IsValid() {
+		return true
+	}
+	switch v.Kind() {
+	case reflect.Array, reflect.Chan, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Complex64, reflect.Complex128:
+		return v.Complex() == 0
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+func defaultValue(d interface{}, given ...interface{}) interface{} {
+	if len(given) == 0 || empty(given[0]) {
+		return d
+	}
+	return given[0]
+}
+
+func coalesce(v ...interface{}) interface{} {
+	for _, val := range v {
+		if !empty(val) {
+			return val
+		}
+	}
+	return nil
+}
+
+// errRequired is returned by the 'required' function
+type errRequired struct {
+	message string
+}
+
+func (e *errRequired) Error() string {
+	return e.message
+}
+
+func required(message string, given interface{}) (interface{}, error) {
+	if given == nil {
+		return nil, &errRequired{message: message}
+	}
+	if s, ok := given.(string); ok && s == "" {
+		return nil, &errRequired{message: message}
+	}
+	return given, nil
+}
+
+func ternary(vt interface{}, vf interface{}, v bool) interface{} {
+	if v {
+		return vt
+	}
+	return vf
+}
+
+func fail(message string) (string, error) {
+	return "", errors.New(message)
+}
+
+func substr(start, end int, s string) string {
+	if start < 0 {
+		start = 0
+	}
+	if end < 0 || end > len(s) {
+		end = len(s)
+	}
+	if start > end {
+		return ""
+	}
+	return s[start:end]
+}
+
+func trunc(c int, s string) string {
+	if c < 0 && len(s)+c > 0 {
+		return s[len(s)+c:]
+	}
+	if c >= 0 && len(s) > c {
+		return s[:c]
+	}
+	return s
+}
+
+func quote(str ...interface{}) string {
+	out := make([]string, 0, len(str))
+	for _, s := range str {
+		if s != nil {
+			out = append(out, fmt.Sprintf("%q", cast.ToString(s)))
+		}
+	}
+	return strings.Join(out, " ")
+}
+
+func squote(str ...interface{}) string {
+	out := make([]string, 0, len(str))
+	for _, s := range str {
+		if s != nil {
+			out = append(out, fmt.Sprintf("'%v'", s))
+		}
+	}
+	return strings.Join(out, " ")
+}
+
+func indent(spaces int, s string) string {
+	pad := strings.Repeat(" ", spaces)
+	return pad + strings.Replace(s, "\n", "\n"+pad, -1)
+}
+
+func join(sep string, v interface{}) string {
+	list := toList(v)
+	out := make([]string, 0, len(list))
+	for _, s := range list {
+		out = append(out, cast.ToString(s))
+	}
+	return strings.Join(out, sep)
+}
+
+func cat(v ...interface{}) string {
+	out := make([]string, 0, len(v))
+	for _, s := range v {
+		if s != nil {
+			out = append(out, cast.ToString(s))
+		}
+	}
+	return strings.Join(out, " ")
+}
+
+func b64dec(s string) (string, error) {
+	dat, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return "", err
+	}
+	return string(dat), nil
+}
+
+func sha256sum(s string) string {
+	hash := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(hash[:])
+}
+
+func toYaml(v interface{}) (string, error) {
+	dat, err := yaml.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(dat), "\n"), nil
+}
+
+func fromYaml(s string) (map[string]interface{}, error) {
+	m := make(map[string]interface{})
+	err := yaml.Unmarshal([]byte(s), &m)
+	if err != nil {
+		return nil, err
+	}
+	return normalizeValue(m).(map[string]interface{}), nil
+}
+
+func toJSON(v interface{}) (string, error) {
+	dat, err := json.Marshal(normalizeValue(v))
+	if err != nil {
+		return "", err
+	}
+	return string(dat), nil
+}
+
+func toPrettyJSON(v interface{}) (string, error) {
+	dat, err := json.MarshalIndent(normalizeValue(v), "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(dat), nil
+}
+
+func fromJSON(s string) (map[string]interface{}, error) {
+	m := make(map[string]interface{})
+	err := json.Unmarshal([]byte(s), &m)
+	return m, err
+}
+
+func toList(v interface{}) []interface{} {
+	val := reflect.ValueOf(v)
+	switch val.Kind() {
+	case reflect.Slice, reflect.Array:
+		list := make([]interface{}, val.Len())
+		for i := 0; i < val.Len(); i++ {
+			list[i] = val.Index(i).Interface()
+		}
+		return list
+	case reflect.Invalid:
+		return []interface{}{}
+	}
+	return []interface{}{v}
+}
+
+func first(v interface{}) interface{} {
+	list := toList(v)
+	if len(list) == 0 {
+		return nil
+	}
+	return list[0]
+}
+
+func last(v interface{}) interface{} {
+	list := toList(v)
+	if len(list) == 0 {
+		return nil
+	}
+	return list[len(list)-1]
+}
+
+func has(needle interface{}, haystack interface{}) bool {
+	for _, v := range toList(haystack) {
+		if reflect.DeepEqual(needle, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func uniq(v interface{}) []interface{} {
+	out := []interface{}{}
+	for _, val := range toList(v) {
+		if !has(val, out) {
+			out = append(out, val)
+		}
+	}
+	return out
+}
+
+func sortAlpha(v interface{}) []string {
+	list := toList(v)
+	out := make([]string, 0, len(list))
+	for _, s := range list {
+		out = append(out, cast.ToString(s))
+	}
+	sort.Strings(out)
+	return out
+}
+
+func dict(v ...interface{}) map[string]interface{} {
+	d := make(map[string]interface{})
+	for i := 0; i+1 < len(v); i += 2 {
+		d[cast.ToString(v[i])] = v[i+1]
+	}
+	if len(v)%2 == 1 {
+		d[cast.ToString(v[len(v)-1])] = ""
+	}
+	return d
+}
+
+func toDict(v interface{}) map[string]interface{} {
+	d, ok := normalizeValue(v).(map[string]interface{})
+	if !ok {
+		return map[string]interface{}{}
+	}
+	return d
+}
+
+func setKey(d interface{}, key string, v interface{}) (interface{}, error) {
+	switch x := d.(type) {
+	case map[string]interface{}:
+		x[key] = v
+	case map[interface{}]interface{}:
+		x[key] = v
+	default:
+		return nil, fmt.Errorf("set: wrong type for dict: %T", d)
+	}
+	return d, nil
+}
+
+func dictKeys(dicts ...interface{}) []string {
+	out := []string{}
+	for _, d := range dicts {
+		for key := range toDict(d) {
+			out = append(out, key)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func div(a, b interface{}) (int64, error) {
+	d := cast.ToInt64(b)
+	if d == 0 {
+		return 0, errors.New("division by zero")
+	}
+	return cast.ToInt64(a) / d, nil
+}
+
+func mod(a, b interface{}) (int64, error) {
+	d := cast.ToInt64(b)
+	if d == 0 {
+		return 0, errors.New("division by zero")
+	}
+	return cast.ToInt64(a) % d, nil
+}
+
+func minMax(a interface{}, v []interface{}, f func(x, y float64) float64) int64 {
+	res := cast.ToFloat64(a)
+	for _, val := range v {
+		res = f(res, cast.ToFloat64(val))
+	}
+	return int64(res)
+}
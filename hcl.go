@@ -0,0 +1,296 @@
+package tpl
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	hcl1ast "github.com/hashicorp/hcl/hcl/ast"
+	hcl1parser "github.com/hashicorp/hcl/hcl/parser"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// unmarshalHCL parses the attributes of HCL2 files like '.tfvars' files.
+// The expressions are evaluated without variables and functions.
+// A block is an object under its type and labels, which must not be repeated
+func unmarshalHCL(dat []byte) (map[string]interface{}, error) {
+	file, diags := hclsyntax.ParseConfig(dat, "", hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return nil, hclDiagError(diags)
+	}
+	return hclBody(file.Body.(*hclsyntax.Body))
+}
+
+func hclDiagError(diags hcl.Diagnostics) error {
+	for _, diag := range diags {
+		if diag.Severity != hcl.DiagError {
+			continue
+		}
+		msg := diag.Summary
+		if diag.Detail != "" {
+			msg += "; " + diag.Detail
+		}
+		if diag.Subject != nil {
+			return &lineError{diag.Subject.Start.Line, msg}
+		}
+		return fmt.Errorf("%s", msg)
+	}
+	return diags
+}
+
+func hclBody(body *hclsyntax.Body) (map[string]interface{}, error) {
+	data := make(map[string]interface{})
+	for name, attr := range body.Attributes {
+		value, diags := attr.Expr.Value(nil)
+		if diags.HasErrors() {
+			return nil, hclDiagError(diags)
+		}
+		data[name] = ctyValue(value)
+	}
+	for _, block := range body.Blocks {
+		value, err := hclBody(block.Body)
+		if err != nil {
+			return nil, err
+		}
+		keys := append([]string{block.Type}, block.Labels...)
+		parent := data
+		for i, key := range keys {
+			if i == len(keys)-1 {
+				if _, ok := parent[key]; ok {
+					return nil, &lineError{block.TypeRange.Start.Line, fmt.Sprintf("duplicate block '%s'", strings.Join(keys, " "))}
+				}
+				parent[key] = value
+				break
+			}
+			child, ok := parent[key].(map[string]interface{})
+			if !ok {
+				if _, exists := parent[key]; exists {
+					return nil, &lineError{block.TypeRange.Start.Line, fmt.Sprintf("block '%s' conflicts with the attribute '%s'", strings.Join(keys, " "), key)}
+				}
+				child = make(map[string]interface{})
+				parent[key] = child
+			}
+			parent = child
+		}
+	}
+	return data, nil
+}
+
+// ctyValue converts the value of an HCL2 expression to the value of a data object
+func ctyValue(value cty.Value) interface{} {
+	if value.IsNull() || !value.IsKnown() {
+		return nil
+	}
+	t := value.Type()
+	switch {
+	case t == cty.String:
+		return value.AsString()
+	case t == cty.Bool:
+		return value.True()
+	case t == cty.Number:
+		bf := value.AsBigFloat()
+		if bf.IsInt() {
+			if i, acc := bf.Int64(); acc == big.Exact {
+				return i
+			}
+		}
+		f, _ := bf.Float64()
+		return f
+	case t.IsListType() || t.IsTupleType() || t.IsSetType():
+		list := []interface{}{}
+		for it := value.ElementIterator(); it.Next(); {
+			_, elem := it.Element()
+			list = append(list, ctyValue(elem))
+		}
+		return list
+	case t.IsMapType() || t.IsObjectType():
+		obj := make(map[string]interface{})
+		for it := value.ElementIterator(); it.Next(); {
+			key, elem := it.Element()
+			obj[key.AsString()] = ctyValue(elem)
+		}
+		return obj
+	}
+	return nil
+}
+
+// unmarshalHCL1 parses the attributes and blocks of HCL1.
+// A block is an object under its keys, and the repeated blocks of the same keys are a list of objects
+func unmarshalHCL1(dat []byte) (data map[string]interface{}, err error) {
+	file, err := hcl1parser.Parse(dat)
+	if err != nil {
+		if posErr, ok := err.(*hcl1parser.PosError); ok {
+			return nil, &lineError{posErr.Pos.Line, posErr.Err.Error()}
+		}
+		return nil, err
+	}
+	// the values of the literal tokens panic if they are malformed
+	defer func() {
+		if r := recover(); r != nil {
+			data, err = nil, fmt.Errorf("%v", r)
+		}
+	}()
+	list, ok := file.Node.(*hcl1ast.ObjectList)
+	if !ok {
+		return nil, fmt.Errorf("unexpected %T at the top level", file.Node)
+	}
+	return hcl1Object(list), nil
+}
+
+func hcl1Object(list *hcl1ast.ObjectList) map[string]interface{} {
+	// group the items by their keys to find the repeated blocks
+	var paths [][]string
+	values := make(map[string][]interface{})
+	for _, item := range list.Items {
+		path := make([]string, len(item.Keys))
+		for i, key := range item.Keys {
+			path[i] = fmt.Sprintf("%v", key.Token.Value())
+		}
+		id := strings.Join(path, "\x00")
+		if _, ok := values[id]; !ok {
+			paths = append(paths, path)
+		}
+		values[id] = append(values[id], hcl1Value(item.Val))
+	}
+	data := make(map[string]interface{})
+	for _, path := range paths {
+		vals := values[strings.Join(path, "\x00")]
+		value := vals[len(vals)-1]
+		if len(vals) > 1 && hcl1AllObjects(vals) {
+			value = vals
+		}
+		parent := data
+		for _, key := range path[:len(path)-1] {
+			child, ok := parent[key].(map[string]interface{})
+			if !ok {
+				child = make(map[string]interface{})
+				parent[key] = child
+			}
+			parent = child
+		}
+		parent[path[len(path)-1]] = value
+	}
+	return data
+}
+
+func hcl1AllObjects(vals []interface{}) bool {
+	for _, val := range vals {
+		if _, ok := val.(map[string]interface{}); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func hcl1Value(node hcl1ast.Node) interface{} {
+	switch n := node.(type) {
+	case *hcl1ast.LiteralType:
+		return n.Token.Value()
+	case *hcl1ast.ListType:
+		list := []interface{}{}
+		for _, elem := range n.List {
+			list = append(list, hcl1Value(elem))
+		}
+		return list
+	case *hcl1ast.ObjectType:
+		return hcl1Object(n.List)
+	}
+	return nil
+}
+
+var hclIdentRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+// marshalHCL writes the data object as HCL2 attributes with object and list values
+func marshalHCL(data map[string]interface{}) (string, error) {
+	for key := range data {
+		if !hclIdentRe.MatchString(key) {
+			return "", fmt.Errorf("key '%s' is not an HCL identifier", key)
+		}
+	}
+	buf := new(bytes.Buffer)
+	writeHCLAttrs(buf, data, "", quoteHCL)
+	return buf.String(), nil
+}
+
+// marshalHCL1 writes the data object as HCL1 attributes with object and list values
+func marshalHCL1(data map[string]interface{}) (string, error) {
+	buf := new(bytes.Buffer)
+	writeHCLAttrs(buf, data, "", strconv.Quote)
+	return buf.String(), nil
+}
+
+// quoteHCL quotes the string for HCL2, escaping the template sequences '${' and '%{'
+func quoteHCL(s string) string {
+	buf := new(strings.Builder)
+	buf.WriteByte('"')
+	for i, r := range s {
+		switch {
+		case r == '"':
+			buf.WriteString(`\"`)
+		case r == '\\':
+			buf.WriteString(`\\`)
+		case r == '\n':
+			buf.WriteString(`\n`)
+		case r == '\r':
+			buf.WriteString(`\r`)
+		case r == '\t':
+			buf.WriteString(`\t`)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(buf, `\u%04x`, r)
+		case (r == '$' || r == '%') && strings.HasPrefix(s[i+1:], "{"):
+			buf.WriteRune(r)
+			buf.WriteRune(r)
+		default:
+			buf.WriteRune(r)
+		}
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
+
+func writeHCLAttrs(buf *bytes.Buffer, data map[string]interface{}, indent string, quote func(string) string) {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		name := key
+		if !hclIdentRe.MatchString(key) {
+			name = quote(key)
+		}
+		fmt.Fprintf(buf, "%s%s = ", indent, name)
+		writeHCLValue(buf, data[key], indent, quote)
+		buf.WriteString("\n")
+	}
+}
+
+func writeHCLValue(buf *bytes.Buffer, value interface{}, indent string, quote func(string) string) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		buf.WriteString("{\n")
+		writeHCLAttrs(buf, v, indent+"  ", quote)
+		buf.WriteString(indent + "}")
+	case []interface{}:
+		buf.WriteString("[")
+		for i, val := range v {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			writeHCLValue(buf, val, indent, quote)
+		}
+		buf.WriteString("]")
+	case string:
+		buf.WriteString(quote(v))
+	case nil:
+		buf.WriteString(`""`)
+	default:
+		fmt.Fprintf(buf, "%v", v)
+	}
+}
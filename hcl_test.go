@@ -0,0 +1,109 @@
+package tpl
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUnmarshalHCL(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want map[string]interface{}
+	}{
+		{"tfvars", "region = \"us-east-1\"\ncount = 3\nratio = 0.5\nenabled = true\nnone = null\n",
+			map[string]interface{}{"region": "us-east-1", "count": int64(3), "ratio": 0.5, "enabled": true, "none": nil}},
+		{"expressions", "zones = [\"a\", \"b\"]\ntags = { env = \"prod\" }\nsize = 2 * 4\nname = \"${\"web\"}-1\"\n",
+			map[string]interface{}{"zones": []interface{}{"a", "b"}, "tags": map[string]interface{}{"env": "prod"}, "size": int64(8), "name": "web-1"}},
+		{"one-element list of objects", "rules = [{ port = 80 }]\n",
+			map[string]interface{}{"rules": []interface{}{map[string]interface{}{"port": int64(80)}}}},
+		{"blocks", "db {\n  host = \"h\"\n}\nservice \"web\" {\n  port = 80\n}\nservice \"api\" {\n  port = 81\n}\n",
+			map[string]interface{}{
+				"db":      map[string]interface{}{"host": "h"},
+				"service": map[string]interface{}{"web": map[string]interface{}{"port": int64(80)}, "api": map[string]interface{}{"port": int64(81)}},
+			}},
+	}
+	for _, tc := range tests {
+		got, err := unmarshalHCL([]byte(tc.text))
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %#v, want %#v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestUnmarshalHCLErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+	}{
+		{"syntax", "a = \n"},
+		{"variable", "a = var.x\n"},
+		{"function", "a = upper(\"x\")\n"},
+		{"duplicate block", "db {\n}\ndb {\n}\n"},
+		{"block and attribute", "db = 1\ndb \"x\" {\n}\n"},
+	}
+	for _, tc := range tests {
+		if _, err := unmarshalHCL([]byte(tc.text)); err == nil {
+			t.Errorf("%s: expected error", tc.name)
+		}
+	}
+}
+
+func TestUnmarshalHCL1(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want map[string]interface{}
+	}{
+		{"attributes", "a = \"x\"\nn = 1\nb = true\n",
+			map[string]interface{}{"a": "x", "n": int64(1), "b": true}},
+		{"block", "db {\n  host = \"h\"\n}\n",
+			map[string]interface{}{"db": map[string]interface{}{"host": "h"}}},
+		{"labels", "service \"web\" {\n  port = 80\n}\n",
+			map[string]interface{}{"service": map[string]interface{}{"web": map[string]interface{}{"port": int64(80)}}}},
+		{"repeated blocks", "rule {\n  port = 80\n}\nrule {\n  port = 443\n}\n",
+			map[string]interface{}{"rule": []interface{}{map[string]interface{}{"port": int64(80)}, map[string]interface{}{"port": int64(443)}}}},
+		{"one-element list of objects", "rules = [{ port = 80 }]\n",
+			map[string]interface{}{"rules": []interface{}{map[string]interface{}{"port": int64(80)}}}},
+	}
+	for _, tc := range tests {
+		got, err := unmarshalHCL1([]byte(tc.text))
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %#v, want %#v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestMarshalHCL(t *testing.T) {
+	data := map[string]interface{}{
+		"name": "a \"${x}\" %{y}\n",
+		"tags": map[string]interface{}{"env": "prod", "a.b": 1},
+		"list": []interface{}{1, "x"},
+	}
+	text, err := marshalHCL(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "list = [1, \"x\"]\nname = \"a \\\"$${x}\\\" %%{y}\\n\"\ntags = {\n  \"a.b\" = 1\n  env = \"prod\"\n}\n"
+	if text != want {
+		t.Errorf("got %q, want %q", text, want)
+	}
+	got, err := unmarshalHCL([]byte(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["name"] != data["name"] {
+		t.Errorf("got name %q, want %q", got["name"], data["name"])
+	}
+	if _, err := marshalHCL(map[string]interface{}{"a.b": 1}); err == nil {
+		t.Errorf("expected error writing a top-level key that is not an identifier")
+	}
+}
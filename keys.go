@@ -0,0 +1,401 @@
+package tpl
+
+import (
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// KeyRef holds a data key referenced by a template
+type KeyRef struct {
+	Key        string
+	File       string
+	Line       int
+	Default    interface{}
+	HasDefault bool
+	Required   bool
+	Message    string
+	uses       int
+	guards     int
+}
+
+// Guarded reports whether every use of the key is given to 'default' or 'required',
+// so the key can be missing in the data object
+func (ref *KeyRef) Guarded() bool {
+	return ref.uses > 0 && ref.uses == ref.guards
+}
+
+// Dep is an environment variable, a file or a command a template depends on
+type Dep struct {
+	// Func is one of env, file, readYaml, readJson and exec
+	Func string
+	// Name is the name of the variable, the path of the file or the command line,
+	// or "" if it is not given as a literal
+	Name string
+	File string
+	Line int
+}
+
+// depFuncs are the functions whose arguments are the dependencies of a template
+var depFuncs = map[string]bool{"env": true, "file": true, "readYaml": true, "readJson": true, "exec": true}
+
+// tmplTrees holds the parse trees and the front matter of a template file
+type tmplTrees struct {
+	name        string
+	trees       map[string]*parse.Tree
+	texts       map[string]string
+	frontMatter *FrontMatter
+}
+
+// rootDot is the path of the data object passed to a template
+const rootDot = ""
+
+// unknownDot is used when dot can not be resolved to a data key
+const unknownDot = "?"
+
+func newTmplTrees(t *template.Template, texts map[string]string) *tmplTrees {
+	tt := &tmplTrees{
+		name:  t.Name(),
+		trees: make(map[string]*parse.Tree),
+		texts: texts,
+	}
+	for _, x := range t.Templates() {
+		if x.Tree != nil {
+			tt.trees[x.Name()] = x.Tree
+		}
+	}
+	return tt
+}
+
+// keyVar maps a template variable to the key it holds
+type keyVar struct {
+	name string
+	key  string
+}
+
+type keyWalker struct {
+	tt      *tmplTrees
+	refs    []*KeyRef
+	seen    map[string]*KeyRef
+	deps    []*Dep
+	vars    []keyVar
+	calling map[string]bool
+}
+
+// walkTrees walks the parse trees from the root template
+func (tt *tmplTrees) walkTrees() *keyWalker {
+	w := &keyWalker{
+		tt:      tt,
+		seen:    make(map[string]*KeyRef),
+		calling: make(map[string]bool),
+	}
+	w.walkTemplate(tt.name, rootDot)
+	return w
+}
+
+// collectKeys returns the keys referenced by the templates in order of first appearance
+func (tt *tmplTrees) collectKeys() []*KeyRef {
+	return tt.walkTrees().refs
+}
+
+// collectDeps returns the dependencies of the templates in order of first appearance
+func (tt *tmplTrees) collectDeps() []*Dep {
+	return tt.walkTrees().deps
+}
+
+// leafKeys returns the keys that are not a parent of other keys
+func leafKeys(refs []*KeyRef) []*KeyRef {
+	keys := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		keys = append(keys, ref.Key)
+	}
+	sort.Strings(keys)
+	parents := make(map[string]bool)
+	for i := 0; i+1 < len(keys); i++ {
+		if isParentKey(keys[i], keys[i+1]) {
+			parents[keys[i]] = true
+		}
+	}
+	leaves := []*KeyRef{}
+	for _, ref := range refs {
+		if !parents[ref.Key] {
+			leaves = append(leaves, ref)
+		}
+	}
+	return leaves
+}
+
+func isParentKey(parent, key string) bool {
+	return strings.HasPrefix(key, parent+".") || strings.HasPrefix(key, parent+"[")
+}
+
+func (w *keyWalker) walkTemplate(name string, dot string) {
+	tree, ok := w.tt.trees[name]
+	if !ok || tree.Root == nil || w.calling[name] {
+		return
+	}
+	w.calling[name] = true
+	vars := w.vars
+	w.vars = []keyVar{{name: "$", key: dot}}
+	w.walk(tree, tree.Root, dot)
+	w.vars = vars
+	w.calling[name] = false
+}
+
+func (w *keyWalker) addRef(tree *parse.Tree, node parse.Node, key string) {
+	if key == rootDot || strings.HasPrefix(key, unknownDot) {
+		return
+	}
+	if ref, ok := w.seen[key]; ok {
+		ref.uses++
+		return
+	}
+	ref := &KeyRef{Key: key, File: tree.ParseName, Line: w.line(tree, node), uses: 1}
+	w.seen[key] = ref
+	w.refs = append(w.refs, ref)
+}
+
+// line returns the line number of the node, or 0 if the text of the tree is unknown
+func (w *keyWalker) line(tree *parse.Tree, node parse.Node) int {
+	text, ok := w.tt.texts[tree.ParseName]
+	pos := int(node.Position())
+	if ok && pos <= len(text) {
+		return strings.Count(text[:pos], "\n") + 1
+	}
+	return 0
+}
+
+// addDep records the call of a function of depFuncs with the arguments,
+// which include the piped value if any
+func (w *keyWalker) addDep(tree *parse.Tree, cmd *parse.CommandNode, args []parse.Node) {
+	name := cmd.Args[0].(*parse.IdentifierNode).Ident
+	texts := []string{}
+	for _, arg := range args {
+		s, ok := arg.(*parse.StringNode)
+		if !ok {
+			texts = nil
+			break
+		}
+		texts = append(texts, s.Text)
+	}
+	dep := &Dep{Func: name, Name: strings.Join(texts, " "), File: tree.ParseName, Line: w.line(tree, cmd)}
+	for _, d := range w.deps {
+		if d.Func == dep.Func && d.Name == dep.Name {
+			return
+		}
+	}
+	w.deps = append(w.deps, dep)
+}
+
+// depFunc reports whether the command is a call of a function of depFuncs
+func depFunc(cmd *parse.CommandNode) bool {
+	ident, ok := cmd.Args[0].(*parse.IdentifierNode)
+	return ok && depFuncs[ident.Ident]
+}
+
+// guardRef records that the key is given to 'default' or 'required'
+func (w *keyWalker) guardRef(key string, cmd *parse.CommandNode) {
+	ref, ok := w.seen[key]
+	if !ok {
+		return
+	}
+	ref.guards++
+	switch cmd.Args[0].(*parse.IdentifierNode).Ident {
+	case "default":
+		if !ref.HasDefault {
+			ref.HasDefault = true
+			ref.Default = literalValue(cmd.Args[1])
+		}
+	case "required":
+		ref.Required = true
+		if s, ok := cmd.Args[1].(*parse.StringNode); ok {
+			ref.Message = s.Text
+		}
+	}
+}
+
+// guardFunc returns the name of the function if the command is a call of
+// 'default' or 'required' with the given number of arguments
+func guardFunc(cmd *parse.CommandNode, nargs int) string {
+	if len(cmd.Args) != nargs+1 {
+		return ""
+	}
+	ident, ok := cmd.Args[0].(*parse.IdentifierNode)
+	if !ok {
+		return ""
+	}
+	switch ident.Ident {
+	case "default", "required":
+		return ident.Ident
+	}
+	return ""
+}
+
+// literalValue returns the value of a constant node, or an empty string
+func literalValue(node parse.Node) interface{} {
+	switch n := node.(type) {
+	case *parse.StringNode:
+		return n.Text
+	case *parse.BoolNode:
+		return n.True
+	case *parse.NumberNode:
+		if n.IsInt {
+			return n.Int64
+		}
+		if n.IsFloat {
+			return n.Float64
+		}
+	case *parse.NilNode:
+		return nil
+	}
+	return ""
+}
+
+func (w *keyWalker) walk(tree *parse.Tree, node parse.Node, dot string) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			w.walk(tree, child, dot)
+		}
+	case *parse.ActionNode:
+		w.walkPipe(tree, n.Pipe, dot)
+	case *parse.IfNode:
+		mark := len(w.vars)
+		w.walkPipe(tree, n.Pipe, dot)
+		w.walk(tree, n.List, dot)
+		w.walk(tree, n.ElseList, dot)
+		w.vars = w.vars[:mark]
+	case *parse.WithNode:
+		mark := len(w.vars)
+		key := w.walkPipe(tree, n.Pipe, dot)
+		w.walk(tree, n.List, key)
+		w.walk(tree, n.ElseList, dot)
+		w.vars = w.vars[:mark]
+	case *parse.RangeNode:
+		mark := len(w.vars)
+		key := w.walkPipe(tree, n.Pipe, dot)
+		elem := unknownDot
+		if key != unknownDot {
+			elem = key + "[0]"
+		}
+		if n.Pipe != nil && len(n.Pipe.Decl) > 0 {
+			// range $i, $v := pipeline
+			decl := n.Pipe.Decl
+			w.vars = w.vars[:len(w.vars)-len(decl)]
+			if len(decl) == 1 {
+				w.vars = append(w.vars, keyVar{name: decl[0].Ident[0], key: elem})
+			} else {
+				w.vars = append(w.vars, keyVar{name: decl[0].Ident[0], key: unknownDot})
+				w.vars = append(w.vars, keyVar{name: decl[1].Ident[0], key: elem})
+			}
+		}
+		w.walk(tree, n.List, elem)
+		w.walk(tree, n.ElseList, dot)
+		w.vars = w.vars[:mark]
+	case *parse.TemplateNode:
+		key := dot
+		if n.Pipe != nil {
+			key = w.walkPipe(tree, n.Pipe, dot)
+		} else {
+			key = unknownDot
+		}
+		w.walkTemplate(n.Name, key)
+	}
+}
+
+// walkPipe records the keys of a pipeline and returns the key of its result
+func (w *keyWalker) walkPipe(tree *parse.Tree, pipe *parse.PipeNode, dot string) string {
+	if pipe == nil {
+		return unknownDot
+	}
+	key := unknownDot
+	for i, cmd := range pipe.Cmds {
+		if depFunc(cmd) {
+			args := cmd.Args[1:]
+			if i > 0 {
+				// "HOME" | env
+				piped := parse.Node(nil)
+				if prev := pipe.Cmds[i-1]; len(prev.Args) == 1 {
+					piped = prev.Args[0]
+				}
+				args = append(append([]parse.Node{}, args...), piped)
+			}
+			w.addDep(tree, cmd, args)
+		}
+		prev := key
+		key = w.walkCmd(tree, cmd, dot)
+		// .key | default value
+		if i > 0 && guardFunc(cmd, 1) != "" {
+			w.guardRef(prev, cmd)
+			key = prev
+		}
+	}
+	for _, v := range pipe.Decl {
+		w.vars = append(w.vars, keyVar{name: v.Ident[0], key: key})
+	}
+	return key
+}
+
+// walkCmd records the keys of a command and returns the key of its result
+func (w *keyWalker) walkCmd(tree *parse.Tree, cmd *parse.CommandNode, dot string) string {
+	key := unknownDot
+	for _, arg := range cmd.Args {
+		key = w.walkArg(tree, arg, dot)
+	}
+	// default value .key
+	if guardFunc(cmd, 2) != "" {
+		w.guardRef(key, cmd)
+		return key
+	}
+	if len(cmd.Args) != 1 {
+		return unknownDot
+	}
+	return key
+}
+
+func (w *keyWalker) walkArg(tree *parse.Tree, arg parse.Node, dot string) string {
+	switch n := arg.(type) {
+	case *parse.DotNode:
+		w.addRef(tree, n, dot)
+		return dot
+	case *parse.FieldNode:
+		key := joinKey(dot, n.Ident)
+		w.addRef(tree, n, key)
+		return key
+	case *parse.VariableNode:
+		key := joinKey(w.lookupVar(n.Ident[0]), n.Ident[1:])
+		w.addRef(tree, n, key)
+		return key
+	case *parse.ChainNode:
+		key := unknownDot
+		if pipe, ok := n.Node.(*parse.PipeNode); ok {
+			key = w.walkPipe(tree, pipe, dot)
+		}
+		key = joinKey(key, n.Field)
+		w.addRef(tree, n, key)
+		return key
+	case *parse.PipeNode:
+		return w.walkPipe(tree, n, dot)
+	}
+	return unknownDot
+}
+
+func (w *keyWalker) lookupVar(name string) string {
+	for i := len(w.vars) - 1; i >= 0; i-- {
+		if w.vars[i].name == name {
+			return w.vars[i].key
+		}
+	}
+	return unknownDot
+}
+
+func joinKey(key string, idents []string) string {
+	if key == unknownDot || len(idents) == 0 {
+		return key
+	}
+	return key + "." + strings.Join(idents, ".")
+}
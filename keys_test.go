@@ -0,0 +1,101 @@
+package tpl
+
+import (
+	"reflect"
+	"testing"
+	"text/template"
+)
+
+func parseTmplTrees(t *testing.T, text string) *tmplTrees {
+	tmpl, err := template.New("t").Funcs((&Tmpl{TmplOpts: &TmplOpts{}}).funcMap()).Parse(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newTmplTrees(tmpl, map[string]string{"t": text})
+}
+
+func TestCollectKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"fields", "{{ .a }} {{ .b.c }}", []string{".a", ".b.c"}},
+		{"with", "{{ with .redis }}{{ .image }}{{ else }}{{ .x }}{{ end }}", []string{".redis", ".redis.image", ".x"}},
+		{"range", "{{ range .hosts }}{{ .name }}{{ end }}", []string{".hosts", ".hosts[0].name"}},
+		{"range value", "{{ range $v := .hosts }}{{ $v.name }}{{ end }}", []string{".hosts", ".hosts[0].name"}},
+		{"range key value", "{{ range $k, $v := .hosts }}{{ $k }}{{ $v }}{{ $v.port }}{{ end }}", []string{".hosts", ".hosts[0]", ".hosts[0].port"}},
+		{"root variable", "{{ with .a }}{{ $.b }}{{ .c }}{{ end }}", []string{".a", ".b", ".a.c"}},
+		{"variable", "{{ $db := .db }}{{ $db.host }}", []string{".db", ".db.host"}},
+		{"nested range", "{{ range .a }}{{ range .b }}{{ .c }}{{ end }}{{ end }}", []string{".a", ".a[0].b", ".a[0].b[0].c"}},
+		{"if", "{{ if .on }}{{ .x }}{{ end }}", []string{".on", ".x"}},
+		{"function args", "{{ printf \"%s\" .a | upper }}", []string{".a"}},
+		{"template", "{{ define \"sub\" }}{{ .host }}{{ end }}{{ template \"sub\" .db }}", []string{".db", ".db.host"}},
+		{"template root", "{{ define \"sub\" }}{{ .x }}{{ $.y }}{{ end }}{{ template \"sub\" . }}", []string{".x", ".y"}},
+		{"template without data", "{{ define \"sub\" }}{{ .x }}{{ end }}{{ template \"sub\" }}", nil},
+		{"recursion", "{{ define \"sub\" }}{{ .x }}{{ template \"sub\" . }}{{ end }}{{ template \"sub\" . }}", []string{".x"}},
+		{"unknown dot", "{{ range list 1 2 }}{{ .x }}{{ end }}", nil},
+	}
+	for _, tc := range tests {
+		var got []string
+		for _, ref := range parseTmplTrees(t, tc.text).collectKeys() {
+			got = append(got, ref.Key)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestCollectKeysGuards(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want KeyRef
+	}{
+		{"default piped", "{{ .a | default \"x\" }}", KeyRef{Key: ".a", Default: "x", HasDefault: true}},
+		{"default arg", "{{ default 3 .a }}", KeyRef{Key: ".a", Default: int64(3), HasDefault: true}},
+		{"required", "{{ required \"set a\" .a }}", KeyRef{Key: ".a", Required: true, Message: "set a"}},
+		{"required piped", "{{ .a | required \"set a\" }}", KeyRef{Key: ".a", Required: true, Message: "set a"}},
+		{"unguarded", "{{ .a }}", KeyRef{Key: ".a"}},
+	}
+	for _, tc := range tests {
+		refs := parseTmplTrees(t, tc.text).collectKeys()
+		if len(refs) != 1 {
+			t.Errorf("%s: got %d keys, want 1", tc.name, len(refs))
+			continue
+		}
+		ref := refs[0]
+		got := KeyRef{Key: ref.Key, Default: ref.Default, HasDefault: ref.HasDefault, Required: ref.Required, Message: ref.Message}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %+v, want %+v", tc.name, got, tc.want)
+		}
+		if guarded := tc.want.HasDefault || tc.want.Required; ref.Guarded() != guarded {
+			t.Errorf("%s: got guarded %v, want %v", tc.name, ref.Guarded(), guarded)
+		}
+	}
+	// a key used without a guard anywhere must be in the data
+	refs := parseTmplTrees(t, "{{ .a | default 1 }}{{ .a }}").collectKeys()
+	if len(refs) != 1 || refs[0].Guarded() {
+		t.Errorf("got guarded key for an unguarded use")
+	}
+}
+
+func TestCollectDeps(t *testing.T) {
+	text := "{{ env \"HOME\" }}{{ \"USER\" | env }}{{ file .f }}{{ exec \"git\" \"rev-parse\" }}{{ env \"HOME\" }}"
+	var got []Dep
+	for _, dep := range parseTmplTrees(t, text).collectDeps() {
+		got = append(got, Dep{Func: dep.Func, Name: dep.Name})
+	}
+	want := []Dep{{"env", "HOME", "", 0}, {"env", "USER", "", 0}, {"file", "", "", 0}, {"exec", "git rev-parse", "", 0}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestCollectKeysLine(t *testing.T) {
+	refs := parseTmplTrees(t, "a\n{{ .a }}\n\n{{ .b }}").collectKeys()
+	if len(refs) != 2 || refs[0].Line != 2 || refs[1].Line != 4 {
+		t.Errorf("got lines of %+v, want 2 and 4", refs)
+	}
+}
@@ -0,0 +1,259 @@
+package tpl
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// lineError is an error at a line of a data file
+type lineError struct {
+	line int
+	msg  string
+}
+
+func (e *lineError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.line, e.msg)
+}
+
+var kvKeyRe = regexp.MustCompile(`^\.?[A-Za-z0-9_\-]+(\.?\[[0-9]+\]|\.[A-Za-z0-9_\-]+)*$`)
+
+// kvSyntax tells how the lines of kv and dotenv files are parsed
+type kvSyntax struct {
+	// interpolate replaces '${VAR}', '$VAR' and '${VAR:-default}' in unquoted and
+	// double quoted values with the value of a key above or of the environment variable
+	interpolate bool
+	// skipInvalid skips the lines without '=' instead of failing
+	skipInvalid bool
+}
+
+var (
+	// kvSyntaxKv keeps the values of kv files literal and skips other lines like 'printenv' output
+	kvSyntaxKv = kvSyntax{skipInvalid: true}
+	// kvSyntaxDotenv interpolates the values of dotenv files
+	kvSyntaxDotenv = kvSyntax{interpolate: true}
+	// kvSyntaxForm reads the form edited by the user as it is written
+	kvSyntaxForm = kvSyntax{}
+)
+
+// parseKeyValues parses 'key=value' lines of kv and dotenv files.
+// Lines may start with 'export', and lines starting with '#' are comments.
+// Unquoted values end at ' #', single quoted values are kept as they are,
+// and double quoted values have escapes like '\n'. Quoted values may span lines.
+// A key can have a type hint like 'replicas:int=3', see ValueTypes.
+// The values without type hints are strings, or inferred if infer is true
+func parseKeyValues(dat []byte, syntax kvSyntax, infer bool) (map[string]interface{}, error) {
+	entries, err := parseKeyValueEntries(dat, syntax)
+	if err != nil {
+		return nil, err
+	}
+	typed := make(map[string]interface{})
+	for _, e := range entries {
+		key := appendKeyPrefix(e.key)
+		switch {
+		case e.typ != "":
+			typed[key], err = convertValue(e.value, e.typ)
+			if err != nil {
+				return nil, &lineError{e.line, err.Error()}
+			}
+		case infer:
+			typed[key] = inferValue(e.value)
+		default:
+			typed[key] = e.value
+		}
+	}
+	return expand(typed), nil
+}
+
+// kvEntry is a 'key:type=value' line of a kv file
+type kvEntry struct {
+	key   string
+	typ   string
+	value string
+	line  int
+}
+
+// parseKeyValueEntries parses the lines of a kv file into the unconverted entries in order
+func parseKeyValueEntries(dat []byte, syntax kvSyntax) ([]*kvEntry, error) {
+	kv := make(map[string]string)
+	var entries []*kvEntry
+	var lookup func(string) (string, bool)
+	if syntax.interpolate {
+		lookup = func(name string) (string, bool) {
+			for _, key := range []string{name, appendKeyPrefix(name), trimKeyPrefix(name)} {
+				if value, ok := kv[key]; ok {
+					return value, true
+				}
+			}
+			return os.LookupEnv(name)
+		}
+	}
+	text := strings.TrimPrefix(strings.Replace(string(dat), "\r\n", "\n", -1), "\ufeff")
+	lines := strings.Split(text, "\n")
+	for i := 0; i < len(lines); i++ {
+		n := i + 1
+		// only the leading spaces are trimmed, as the trailing ones
+		// may belong to a quoted value continued on the next lines
+		line := strings.TrimLeft(lines[i], " \t")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "export ") || strings.HasPrefix(line, "export\t") {
+			line = strings.TrimLeft(line[len("export"):], " \t")
+		}
+		eq := strings.Index(line, "=")
+		if eq < 0 {
+			if syntax.skipInvalid {
+				continue
+			}
+			return nil, &lineError{n, "key=value is expected"}
+		}
+		key, typ, err := splitTypeHint(strings.TrimSpace(line[:eq]))
+		if err != nil {
+			return nil, &lineError{n, err.Error()}
+		}
+		if !kvKeyRe.MatchString(key) {
+			return nil, &lineError{n, fmt.Sprintf("invalid key '%s'", key)}
+		}
+		raw := strings.TrimLeft(line[eq+1:], " \t")
+		var value string
+		if raw != "" && (raw[0] == '"' || raw[0] == '\'') {
+			// join the following lines until the closing quote
+			for !hasClosingQuote(raw) && i+1 < len(lines) {
+				i++
+				raw += "\n" + lines[i]
+			}
+			value, err = quotedValue(raw, lookup)
+		} else {
+			value, err = unquotedValue(raw, lookup)
+		}
+		if err != nil {
+			return nil, &lineError{n, err.Error()}
+		}
+		kv[key] = value
+		entries = append(entries, &kvEntry{key, typ, value, n})
+	}
+	return entries, nil
+}
+
+// hasClosingQuote reports whether the quoted value starting with a quote is closed
+func hasClosingQuote(raw string) bool {
+	q := raw[0]
+	for i := 1; i < len(raw); i++ {
+		switch {
+		case q == '"' && raw[i] == '\\':
+			i++
+		case raw[i] == q:
+			return true
+		}
+	}
+	return false
+}
+
+var kvUnescapes = map[byte]string{'n': "\n", 'r': "\r", 't': "\t"}
+
+// quotedValue returns the value of the quoted raw text.
+// Variables are replaced in double quotes if lookup is not nil
+func quotedValue(raw string, lookup func(string) (string, bool)) (string, error) {
+	q := raw[0]
+	buf := new(strings.Builder)
+	end := -1
+	for i := 1; i < len(raw) && end < 0; i++ {
+		c := raw[i]
+		switch {
+		case c == q:
+			end = i
+		case q == '"' && c == '\\' && i+1 < len(raw):
+			i++
+			if s, ok := kvUnescapes[raw[i]]; ok {
+				buf.WriteString(s)
+			} else {
+				buf.WriteByte(raw[i])
+			}
+		case q == '"' && c == '$' && lookup != nil:
+			value, next, err := expandVar(raw, i, lookup)
+			if err != nil {
+				return "", err
+			}
+			buf.WriteString(value)
+			i = next - 1
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	if end < 0 {
+		if q == '"' {
+			return "", fmt.Errorf("unterminated double quote")
+		}
+		return "", fmt.Errorf("unterminated single quote")
+	}
+	rest := strings.TrimSpace(raw[end+1:])
+	if rest != "" && !strings.HasPrefix(rest, "#") {
+		return "", fmt.Errorf("unexpected '%s' after the quoted value", rest)
+	}
+	return buf.String(), nil
+}
+
+// unquotedValue returns the value of the raw text up to a comment.
+// Variables are replaced if lookup is not nil
+func unquotedValue(raw string, lookup func(string) (string, bool)) (string, error) {
+	if i := strings.Index(raw, " #"); i >= 0 {
+		raw = raw[:i]
+	}
+	if i := strings.Index(raw, "\t#"); i >= 0 {
+		raw = raw[:i]
+	}
+	raw = strings.TrimSpace(raw)
+	buf := new(strings.Builder)
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		switch {
+		case c == '\\' && i+1 < len(raw) && raw[i+1] == '$' && lookup != nil:
+			i++
+			buf.WriteByte('$')
+		case c == '$' && lookup != nil:
+			value, next, err := expandVar(raw, i, lookup)
+			if err != nil {
+				return "", err
+			}
+			buf.WriteString(value)
+			i = next - 1
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	return buf.String(), nil
+}
+
+var kvVarNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*`)
+
+// expandVar returns the value of the variable reference at raw[i] that is '$'
+// and the index after the reference. A '$' without a name is kept
+func expandVar(raw string, i int, lookup func(string) (string, bool)) (string, int, error) {
+	if i+1 < len(raw) && raw[i+1] == '{' {
+		end := strings.Index(raw[i:], "}")
+		if end < 0 {
+			return "", 0, fmt.Errorf("unterminated variable reference '%s'", raw[i:])
+		}
+		ref := raw[i+2 : i+end]
+		name, def, hasDef := ref, "", false
+		if j := strings.Index(ref, ":-"); j >= 0 {
+			name, def, hasDef = ref[:j], ref[j+2:], true
+		}
+		if name == "" {
+			return "", 0, fmt.Errorf("empty variable reference")
+		}
+		value, ok := lookup(name)
+		if (!ok || value == "") && hasDef {
+			value = def
+		}
+		return value, i + end + 1, nil
+	}
+	name := kvVarNameRe.FindString(raw[i+1:])
+	if name == "" {
+		return "$", i + 1, nil
+	}
+	value, _ := lookup(name)
+	return value, i + 1 + len(name), nil
+}
@@ -0,0 +1,136 @@
+package tpl
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestParseKeyValueEntries(t *testing.T) {
+	os.Setenv("TPL_TEST_KV", "from-env")
+	defer os.Unsetenv("TPL_TEST_KV")
+	tests := []struct {
+		name string
+		text string
+		want map[string]string
+	}{
+		{"plain", "a=1\nb = two words \n", map[string]string{"a": "1", "b": "two words"}},
+		{"comments", "# comment\n\na=1 # trailing\nb=x#y\n", map[string]string{"a": "1", "b": "x#y"}},
+		{"export", "export a=1\n  export\tb=2\n", map[string]string{"a": "1", "b": "2"}},
+		{"single quotes", `a='$HOME \n "x"'`, map[string]string{"a": `$HOME \n "x"`}},
+		{"double quotes", `a="x\ty\n\"z\" \\"`, map[string]string{"a": "x\ty\n\"z\" \\"}},
+		{"quote comment", `a="x" # comment`, map[string]string{"a": "x"}},
+		{"multi-line", "a=\"foo\nbar\"\nb='x\n  y'\n", map[string]string{"a": "foo\nbar", "b": "x\n  y"}},
+		{"multi-line trailing spaces", "trail=\"foo   \nbar\"\n", map[string]string{"trail": "foo   \nbar"}},
+		{"interpolation", "a=1\nb=${a}-$a\nc=\"${TPL_TEST_KV}\"\nd='${a}'\n", map[string]string{"a": "1", "b": "1-1", "c": "from-env", "d": "${a}"}},
+		{"interpolation default", "a=${TPL_TEST_NONE:-def}\nb=${TPL_TEST_KV:-def}\n", map[string]string{"a": "def", "b": "from-env"}},
+		{"escaped dollar", `a=\$HOME`, map[string]string{"a": "$HOME"}},
+		{"lone dollar", `a=5$`, map[string]string{"a": "5$"}},
+		{"crlf", "a=1\r\nb=2\r\n", map[string]string{"a": "1", "b": "2"}},
+	}
+	for _, tc := range tests {
+		entries, err := parseKeyValueEntries([]byte(tc.text), kvSyntaxDotenv)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		got := make(map[string]string)
+		for _, e := range entries {
+			got[e.key] = e.value
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestParseKeyValueEntriesErrors(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"a=1\nnovalue\n", "line 2: key=value is expected"},
+		{"a=1\n\nb c=2\n", "line 3: invalid key 'b c'"},
+		{"a=\"open\nb=2\n", "line 1: unterminated double quote"},
+		{"a='open", "line 1: unterminated single quote"},
+		{`a="x" y`, "line 1: unexpected 'y' after the quoted value"},
+		{"a=${", "line 1: unterminated variable reference '${'"},
+		{"a=${}", "line 1: empty variable reference"},
+	}
+	for _, tc := range tests {
+		_, err := parseKeyValueEntries([]byte(tc.text), kvSyntaxDotenv)
+		if err == nil || err.Error() != tc.want {
+			t.Errorf("%q: got error %v, want %s", tc.text, err, tc.want)
+		}
+	}
+}
+
+func TestParseKeyValueEntriesKv(t *testing.T) {
+	os.Setenv("TPL_TEST_KV", "from-env")
+	defer os.Unsetenv("TPL_TEST_KV")
+	// kv values are literal, and lines without '=' are skipped
+	text := "password=pa$word\nb=${TPL_TEST_KV}\nc=\\$x\nd=\"$a\\$b\"\ncontinued line\ne=1\n"
+	entries, err := parseKeyValueEntries([]byte(text), kvSyntaxKv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]string)
+	for _, e := range entries {
+		got[e.key] = e.value
+	}
+	want := map[string]string{"password": "pa$word", "b": "${TPL_TEST_KV}", "c": `\$x`, "d": "$a$b", "e": "1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	// the form is read as it is written, but reports lines without '='
+	if _, err := parseKeyValueEntries([]byte("a=$b\nnovalue\n"), kvSyntaxForm); err == nil || err.Error() != "line 2: key=value is expected" {
+		t.Errorf("got error %v, want line 2: key=value is expected", err)
+	}
+}
+
+func TestMarshalKv(t *testing.T) {
+	data := map[string]interface{}{"a": "pa$word", "b": " x", "c": "line\nnext", "d": `q"\`}
+	text, err := marshalKv(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := unmarshalKv([]byte(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, data) {
+		t.Errorf("got %q, want %q from %q", got, data, text)
+	}
+	text, err = marshalDotenv(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = unmarshalDotenv([]byte(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, data) {
+		t.Errorf("got %q, want %q from %q", got, data, text)
+	}
+}
+
+func TestParseKeyValues(t *testing.T) {
+	dat := []byte("name=web\nreplicas:int=3\nport=8080\ndb.host=h\nlist[0]=x\n")
+	got, err := parseKeyValues(dat, kvSyntaxKv, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"name":     "web",
+		"replicas": 3,
+		"port":     8080,
+		"db":       map[string]interface{}{"host": "h"},
+		"list":     []interface{}{"x"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %#v, want %#v", got, want)
+	}
+	if _, err := parseKeyValues([]byte("a=1\nn:int=x\n"), kvSyntaxKv, false); err == nil {
+		t.Errorf("expected error converting 'x' to int")
+	}
+}
@@ -0,0 +1,167 @@
+package tpl
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Strategies to merge data objects of multiple data files
+const (
+	// MergeOverride merges objects recursively and later values override earlier ones
+	MergeOverride = "override"
+	// MergeKeepFirst merges objects recursively and keeps the values set first
+	MergeKeepFirst = "keep-first"
+	// MergeAppendLists works like override, but appends later lists to earlier ones
+	MergeAppendLists = "deep-append-lists"
+	// MergeErrorOnConflict fails if a key is set to different values
+	MergeErrorOnConflict = "error-on-conflict"
+)
+
+// MergeStrategies are the names accepted by the merge option
+var MergeStrategies = []string{MergeOverride, MergeKeepFirst, MergeAppendLists, MergeErrorOnConflict}
+
+func validMergeStrategy(strategy string) bool {
+	for _, s := range MergeStrategies {
+		if s == strategy {
+			return true
+		}
+	}
+	return false
+}
+
+// dataMerger merges data objects by the strategy and records the source of each key
+type dataMerger struct {
+	strategy string
+	origins  map[string]string
+}
+
+func newDataMerger(strategy string) *dataMerger {
+	if strategy == "" {
+		strategy = MergeOverride
+	}
+	return &dataMerger{strategy: strategy, origins: make(map[string]string)}
+}
+
+// merge merges the data object src read from the source into dst.
+// The path is the flattened key of dst
+func (m *dataMerger) merge(dst, src map[string]interface{}, source string, path string) error {
+	for key, srcVal := range src {
+		keyPath := path + "." + key
+		dstVal, exists := dst[key]
+		dstMap, dstOk := dstVal.(map[string]interface{})
+		srcMap, srcOk := srcVal.(map[string]interface{})
+		if dstOk && srcOk {
+			if err := m.merge(dstMap, srcMap, source, keyPath); err != nil {
+				return err
+			}
+			continue
+		}
+		if !exists {
+			dst[key] = srcVal
+			m.setOrigin(keyPath, source)
+			continue
+		}
+		switch m.strategy {
+		case MergeKeepFirst:
+		case MergeErrorOnConflict:
+			if !reflect.DeepEqual(dstVal, srcVal) {
+				return fmt.Errorf("conflicting values for key '%s' in '%s' and '%s'",
+					trimKeyPrefix(keyPath), m.sourceOf(keyPath), source)
+			}
+		case MergeAppendLists:
+			dstList, dstOk := dstVal.([]interface{})
+			srcList, srcOk := srcVal.([]interface{})
+			if dstOk && srcOk {
+				list := make([]interface{}, 0, len(dstList)+len(srcList))
+				dst[key] = append(append(list, dstList...), srcList...)
+				m.setOrigin(keyPath, m.sourceOf(keyPath)+", "+source)
+				continue
+			}
+			dst[key] = srcVal
+			m.setOrigin(keyPath, source)
+		default:
+			dst[key] = srcVal
+			m.setOrigin(keyPath, source)
+		}
+	}
+	return nil
+}
+
+// fill merges objects of src into dst by key and lists by index, and returns dst.
+// The precedence is one of EnvPrecedences: src sets the values dst does not have,
+// also the null values of dst with EnvPrecedenceGaps, or overrides the values of dst
+// with EnvPrecedenceEnv. Null elements of the lists of src are gaps and left as they are in dst
+func (m *dataMerger) fill(dst, src interface{}, source string, path string, precedence string) interface{} {
+	if dst == nil {
+		m.setOrigin(path, source)
+		return src
+	}
+	override := precedence == EnvPrecedenceEnv
+	switch s := src.(type) {
+	case map[string]interface{}:
+		d, ok := dst.(map[string]interface{})
+		if !ok {
+			break
+		}
+		for key, val := range s {
+			if dv, exists := d[key]; exists && dv == nil && precedence == EnvPrecedenceFile {
+				continue
+			}
+			d[key] = m.fill(d[key], val, source, path+"."+key, precedence)
+		}
+		return d
+	case []interface{}:
+		d, ok := dst.([]interface{})
+		if !ok {
+			break
+		}
+		for i, val := range s {
+			if val == nil {
+				if i >= len(d) {
+					d = append(d, nil)
+				}
+				continue
+			}
+			keyPath := fmt.Sprintf("%s[%d]", path, i)
+			if i >= len(d) {
+				d = append(d, val)
+				m.setOrigin(keyPath, source)
+				continue
+			}
+			d[i] = m.fill(d[i], val, source, keyPath, precedence)
+		}
+		return d
+	}
+	if override {
+		m.setOrigin(path, source)
+		return src
+	}
+	return dst
+}
+
+// setOrigin records the source of the key, replacing the sources of its children
+func (m *dataMerger) setOrigin(key string, source string) {
+	for k := range m.origins {
+		if isParentKey(key, k) {
+			delete(m.origins, k)
+		}
+	}
+	m.origins[key] = source
+}
+
+// sourceOf returns the source of the flattened key, looking up its parents
+// if the key was set as a part of an object or a list
+func (m *dataMerger) sourceOf(key string) string {
+	for key != "" {
+		if source, ok := m.origins[key]; ok {
+			return source
+		}
+		i := strings.LastIndexAny(key, ".[")
+		if i < 0 {
+			break
+		}
+		key = key[:i]
+	}
+	return ""
+}
@@ -0,0 +1,367 @@
+package tpl
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/mattn/go-isatty"
+	"golang.org/x/term"
+)
+
+// backInput is the input to go back to the previous key
+const backInput = "<"
+
+// ErrBack is returned by Ask to go back to the previous question
+var ErrBack = errors.New("back to the previous question")
+
+// Question holds the missing keys found on a line of a template
+type Question struct {
+	// File is the template file being executed
+	File string
+	// Title tells where the keys are found
+	Title string
+	// Context holds the line and its parent lines, or nil if the context is folded
+	Context []*LineMeta
+	Keys    []*KeyRef
+	// Fields tell how to ask for the keys, in the order of Keys
+	Fields []*Field
+}
+
+// Field tells how to ask for the value of a key
+type Field struct {
+	Key string
+	// Default is used for empty input if HasDefault
+	Default    string
+	HasDefault bool
+	// Type is one of ValueTypes the input is converted to, or "" for strings
+	Type string
+	// Enum lists the allowed values if not empty
+	Enum        []string
+	Description string
+	// Secret input is not echoed
+	Secret bool
+	// Validate checks the input, which is asked again on error
+	Validate func(input string) error
+}
+
+// Prompter asks for the values of missing keys in interactive mode
+// and whether to overwrite existing files
+type Prompter interface {
+	// Ask returns the values of the keys of the question in order,
+	// or ErrBack to go back to the previous question
+	Ask(q *Question) ([]string, error)
+	// Confirm asks the yes or no question
+	Confirm(message string) (bool, error)
+}
+
+// FormPrompter is a prompter that can fill the fields of all the questions at once
+type FormPrompter interface {
+	Prompter
+	// Fill returns the values of the fields in order
+	Fill(fields []*Field) ([]string, error)
+}
+
+// TermPrompter asks questions on a terminal, reading answers line by line
+// from one reader shared by all questions
+type TermPrompter struct {
+	in     *bufio.Reader
+	tty    *os.File
+	out    io.Writer
+	colors *NavColorMeta
+	file   string
+	hinted bool
+	// Editor fills the form, $VISUAL, $EDITOR or vi if empty
+	Editor string
+}
+
+// NewTermPrompter creates a prompter reading from in and writing to out.
+// The colours of the config are used if colors is nil.
+// Secret input is not echoed if in is a terminal
+func NewTermPrompter(in io.Reader, out io.Writer, colors *NavColorMeta) *TermPrompter {
+	if colors == nil {
+		colors = InitializedNavColorMeta()
+	}
+	p := &TermPrompter{in: bufio.NewReader(in), out: out, colors: colors}
+	if f, ok := in.(*os.File); ok && isatty.IsTerminal(f.Fd()) {
+		p.tty = f
+	}
+	return p
+}
+
+var stdinPrompter *TermPrompter
+var stdinPrompterOnce sync.Once
+
+// StdinPrompter returns the prompter on stdin and stdout shared by all Tmpl objects,
+// so that buffered input is not lost between questions
+func StdinPrompter() *TermPrompter {
+	stdinPrompterOnce.Do(func() {
+		stdinPrompter = NewTermPrompter(os.Stdin, os.Stdout, nil)
+	})
+	return stdinPrompter
+}
+
+// readLine reads a line. io.EOF is returned only if the input ended before any character
+func (p *TermPrompter) readLine() (string, error) {
+	line, err := p.in.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	return strings.TrimRight(line, "\r\n"), err
+}
+
+// readSecret reads a line without the echo if the input is a terminal
+func (p *TermPrompter) readSecret() (string, error) {
+	if p.tty == nil || p.in.Buffered() > 0 {
+		return p.readLine()
+	}
+	dat, err := term.ReadPassword(int(p.tty.Fd()))
+	io.WriteString(p.out, "\n")
+	return string(dat), err
+}
+
+// Ask shows the file once, the context of the keys and reads a line for each field.
+// An empty line takes the default, invalid input is asked again
+// and '<' goes back to the previous key
+func (p *TermPrompter) Ask(q *Question) ([]string, error) {
+	c := p.colors
+	if q.File != p.file {
+		c.NavFile.Fprintf(p.out, "[%s]\n", q.File)
+		p.file = q.File
+	}
+	if !p.hinted {
+		c.NavContext.Fprintf(p.out, "(enter '%s' to go back to the previous key)\n", backInput)
+		p.hinted = true
+	}
+	if q.Context != nil {
+		c.NavTitle.Fprintf(p.out, "%s\n", q.Title)
+		for _, lineMeta := range q.Context {
+			c.NavContext.Fprintf(p.out, "%s\n", lineMeta.Line)
+		}
+	}
+	fields := questionFields(q)
+	values := make([]string, len(fields))
+	for i := 0; i < len(fields); {
+		f := fields[i]
+		if f.Description != "" {
+			c.NavContext.Fprintf(p.out, "# %s\n", f.Description)
+		}
+		c.NavInput.Fprintf(p.out, "value for '%s'%s: ", f.Key, fieldHint(f))
+		var val string
+		var err error
+		if f.Secret {
+			val, err = p.readSecret()
+		} else {
+			val, err = p.readLine()
+			val = strings.TrimSpace(val)
+		}
+		eof := err == io.EOF
+		if err != nil && !eof {
+			return nil, err
+		}
+		if val == backInput {
+			if i == 0 {
+				return nil, ErrBack
+			}
+			i--
+			continue
+		}
+		if val == "" && f.HasDefault {
+			val = f.Default
+		}
+		if f.Validate != nil {
+			if err := f.Validate(val); err != nil {
+				if eof {
+					return nil, fmt.Errorf("wrong value for '%s': %v", f.Key, err)
+				}
+				c.NavTitle.Fprintf(p.out, "  %v\n", err)
+				continue
+			}
+		}
+		values[i] = val
+		i++
+	}
+	if q.Context != nil {
+		io.WriteString(p.out, "\n")
+	}
+	return values, nil
+}
+
+// questionFields returns the fields of the question, or plain fields of its keys
+func questionFields(q *Question) []*Field {
+	if len(q.Fields) == len(q.Keys) {
+		return q.Fields
+	}
+	fields := make([]*Field, len(q.Keys))
+	for i, ref := range q.Keys {
+		fields[i] = &Field{Key: ref.Key}
+	}
+	return fields
+}
+
+// fieldHint shows the type, the allowed values and the default of the field
+func fieldHint(f *Field) string {
+	hint := ""
+	if len(f.Enum) > 0 {
+		hint += " (" + strings.Join(f.Enum, "|") + ")"
+	} else if f.Type != "" && f.Type != "string" {
+		hint += " <" + f.Type + ">"
+	}
+	if f.HasDefault {
+		if f.Secret {
+			hint += " [****]"
+		} else {
+			hint += " [" + f.Default + "]"
+		}
+	}
+	return hint
+}
+
+// Confirm reads a line and reports whether it starts with 'y'
+func (p *TermPrompter) Confirm(message string) (bool, error) {
+	io.WriteString(p.out, message+" ")
+	val, err := p.readLine()
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	return strings.HasPrefix(strings.ToLower(strings.TrimSpace(val)), "y"), nil
+}
+
+// Fill writes the fields as 'key=value' lines of a kv file, opens it in the editor
+// and reads the values back. The file is opened again with the errors until every value is valid.
+// Deleting all the lines, or saving the file unchanged after errors, cancels the form.
+// The values are written to a temporary file, so secret fields should be asked with Ask
+func (p *TermPrompter) Fill(fields []*Field) ([]string, error) {
+	f, err := ioutil.TempFile("", "tpl-form-*.env")
+	if err != nil {
+		return nil, err
+	}
+	name := f.Name()
+	f.Close()
+	defer os.Remove(name)
+
+	values := make([]string, len(fields))
+	for i, field := range fields {
+		values[i] = field.Default
+	}
+	form := formText(fields, values, nil)
+	for edited := false; ; {
+		err = ioutil.WriteFile(name, []byte(form), 0600)
+		if err != nil {
+			return nil, err
+		}
+		err = p.edit(name)
+		if err != nil {
+			return nil, err
+		}
+		dat, err := ioutil.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		if edited && string(dat) == form {
+			return nil, errors.New("the form is canceled")
+		}
+		edited = true
+		entries, err := parseKeyValueEntries(dat, kvSyntaxForm)
+		if err != nil {
+			// keep the edited lines and put the error at the end, so that its line number is right
+			lines := strings.Split(strings.TrimRight(string(dat), "\n"), "\n")
+			for len(lines) > 0 && strings.HasPrefix(lines[len(lines)-1], formErrorPrefix) {
+				lines = lines[:len(lines)-1]
+			}
+			form = strings.Join(lines, "\n") + "\n" + formErrorPrefix + err.Error() + "\n"
+			continue
+		}
+		if len(entries) == 0 {
+			return nil, errors.New("the form is canceled")
+		}
+		values, errs := formValues(fields, entries)
+		if len(errs) == 0 {
+			return values, nil
+		}
+		form = formText(fields, values, errs)
+	}
+}
+
+const formErrorPrefix = "# error: "
+
+// edit opens the file in the editor attached to the terminal
+func (p *TermPrompter) edit(file string) error {
+	editor := p.Editor
+	for _, env := range []string{"VISUAL", "EDITOR"} {
+		if editor == "" {
+			editor = os.Getenv(env)
+		}
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	args := strings.Fields(editor)
+	cmd := exec.Command(args[0], append(args[1:], file)...)
+	cmd.Stdin = os.Stdin
+	if p.tty != nil {
+		cmd.Stdin = p.tty
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err := cmd.Run()
+	if err != nil {
+		return fmt.Errorf("failed to run editor '%s': %v", editor, err)
+	}
+	return nil
+}
+
+// formText writes the errors, the hints of the fields and their values
+func formText(fields []*Field, values []string, errs []string) string {
+	buf := new(bytes.Buffer)
+	buf.WriteString("# Fill in the values of the missing keys, then save the file and quit the editor.\n")
+	buf.WriteString("# Values are read like kv data files: quote values with '#' or spaces at the ends.\n")
+	buf.WriteString("# Delete all the lines to cancel.\n")
+	for _, e := range errs {
+		buf.WriteString(formErrorPrefix + e + "\n")
+	}
+	for i, f := range fields {
+		buf.WriteString("\n")
+		if hint := strings.TrimSpace(fieldHint(&Field{Type: f.Type, Enum: f.Enum})); hint != "" {
+			fmt.Fprintf(buf, "# %s\n", hint)
+		}
+		if f.Description != "" {
+			fmt.Fprintf(buf, "# %s\n", f.Description)
+		}
+		fmt.Fprintf(buf, "%s=%s\n", trimKeyPrefix(f.Key), kvValue(values[i]))
+	}
+	return buf.String()
+}
+
+// formValues returns the values of the fields from the entries of the form and the errors
+func formValues(fields []*Field, entries []*kvEntry) ([]string, []string) {
+	index := make(map[string]int)
+	for i, f := range fields {
+		index[f.Key] = i
+	}
+	values := make([]string, len(fields))
+	errs := []string{}
+	for _, e := range entries {
+		i, ok := index[appendKeyPrefix(e.key)]
+		if !ok {
+			errs = append(errs, fmt.Sprintf("line %d: unknown key '%s'", e.line, e.key))
+			continue
+		}
+		values[i] = e.value
+	}
+	for i, f := range fields {
+		if f.Validate != nil {
+			if err := f.Validate(values[i]); err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %v", trimKeyPrefix(f.Key), err))
+			}
+		}
+	}
+	return values, errs
+}
@@ -0,0 +1,96 @@
+package tpl
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// funcMap returns the functions of FuncMap with the functions reading files
+// under the file root and running commands if allowed
+func (tmpl *Tmpl) funcMap() template.FuncMap {
+	funcs := FuncMap()
+	funcs["file"] = tmpl.readFile
+	funcs["readYaml"] = func(name string) (map[string]interface{}, error) {
+		s, err := tmpl.readFile(name)
+		if err != nil {
+			return nil, err
+		}
+		return fromYaml(s)
+	}
+	funcs["readJson"] = func(name string) (map[string]interface{}, error) {
+		s, err := tmpl.readFile(name)
+		if err != nil {
+			return nil, err
+		}
+		m, err := fromJSON(s)
+		if err != nil {
+			return nil, err
+		}
+		return normalizeValue(m).(map[string]interface{}), nil
+	}
+	funcs["exec"] = tmpl.execCommand
+	return funcs
+}
+
+// sandboxPath returns the path of the file under the file root.
+// Relative paths are relative to the root, and paths or symlinks leading out of it are rejected
+func (tmpl *Tmpl) sandboxPath(name string) (string, error) {
+	root := tmpl.TmplOpts.FileRoot
+	if root == "" {
+		root = "."
+	}
+	root, err := filepath.Abs(root)
+	if err == nil {
+		root, err = filepath.EvalSymlinks(root)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to find file root: %v", err)
+	}
+	p := name
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(root, p)
+	}
+	p, err = filepath.EvalSymlinks(p)
+	if err != nil {
+		return "", fmt.Errorf("failed to find file '%s': %v", name, err)
+	}
+	rel, err := filepath.Rel(root, p)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("file '%s' is outside the file root '%s'", name, root)
+	}
+	return p, nil
+}
+
+// readFile returns the content of the file under the file root
+func (tmpl *Tmpl) readFile(name string) (string, error) {
+	p, err := tmpl.sandboxPath(name)
+	if err != nil {
+		return "", err
+	}
+	dat, err := ioutil.ReadFile(p)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file '%s': %v", name, err)
+	}
+	return string(dat), nil
+}
+
+// execCommand runs the command if allowed and returns its output without the trailing newlines
+func (tmpl *Tmpl) execCommand(name string, args ...string) (string, error) {
+	line := strings.Join(append([]string{name}, args...), " ")
+	if !tmpl.TmplOpts.AllowExec {
+		return "", fmt.Errorf("running '%s' is not allowed without the allow-exec option", line)
+	}
+	cmd := exec.Command(name, args...)
+	stderr := new(bytes.Buffer)
+	cmd.Stderr = stderr
+	dat, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to run '%s': %v: %s", line, err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimRight(string(dat), "\r\n"), nil
+}
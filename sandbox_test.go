@@ -0,0 +1,104 @@
+package tpl
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSandboxPath(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	root := filepath.Join(dir, "root")
+	for _, p := range []string{filepath.Join(root, "sub"), filepath.Join(dir, "out")} {
+		if err := os.MkdirAll(p, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, p := range []string{filepath.Join(root, "a"), filepath.Join(root, "sub", "b"), filepath.Join(dir, "secret")} {
+		if err := ioutil.WriteFile(p, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		filepath.Join(root, "out-file"): filepath.Join(dir, "secret"),
+		filepath.Join(root, "out-dir"):  filepath.Join(dir, "out"),
+		filepath.Join(root, "in-file"):  filepath.Join(root, "sub", "b"),
+	}
+	for link, target := range links {
+		if err := os.Symlink(target, link); err != nil {
+			t.Skipf("symlinks are not supported: %v", err)
+		}
+	}
+	tests := []struct {
+		name string
+		file string
+		err  string
+	}{
+		{"relative", "a", ""},
+		{"nested", "sub/b", ""},
+		{"dot dot inside", "sub/../a", ""},
+		{"absolute inside", filepath.Join(root, "sub", "b"), ""},
+		{"symlink inside", "in-file", ""},
+		{"dot dot escape", "../secret", "outside the file root"},
+		{"nested dot dot escape", "sub/../../secret", "outside the file root"},
+		{"absolute outside", filepath.Join(dir, "secret"), "outside the file root"},
+		{"symlink file escape", "out-file", "outside the file root"},
+		{"symlink dir escape", "out-dir", "outside the file root"},
+		{"missing", "none", "failed to find file"},
+	}
+	tmpl := &Tmpl{TmplOpts: &TmplOpts{FileRoot: root}}
+	for _, tc := range tests {
+		_, err := tmpl.sandboxPath(tc.file)
+		if tc.err == "" {
+			if err != nil {
+				t.Errorf("%s: %v", tc.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%s: got error %v, want %q", tc.name, err, tc.err)
+		}
+	}
+	s, err := tmpl.readFile("in-file")
+	if err != nil || s != "x" {
+		t.Errorf("readFile: got %q, %v", s, err)
+	}
+}
+
+func TestExecCommand(t *testing.T) {
+	tests := []struct {
+		name      string
+		allowExec bool
+		cmd       []string
+		want      string
+		err       string
+	}{
+		{"not allowed", false, []string{"echo", "hi"}, "", "not allowed without the allow-exec option"},
+		{"allowed", true, []string{"echo", "hi"}, "hi", ""},
+		{"failed", true, []string{"false"}, "", "failed to run 'false'"},
+	}
+	for _, tc := range tests {
+		if _, err := exec.LookPath(tc.cmd[0]); err != nil {
+			t.Skipf("%s is not found", tc.cmd[0])
+		}
+		tmpl := &Tmpl{TmplOpts: &TmplOpts{AllowExec: tc.allowExec}}
+		got, err := tmpl.execCommand(tc.cmd[0], tc.cmd[1:]...)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%s: got error %v, want %q", tc.name, err, tc.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,459 @@
+package tpl
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// schemaFile is the schema of the data object found next to the templates
+const schemaFile = "values.schema.json"
+
+// schemaFormat is the output format of a starter schema of the keys
+const schemaFormat = "schema"
+
+// Schema is the subset of JSON Schema used to validate the data object:
+// type, properties, required, additionalProperties, items, enum, pattern,
+// minimum, maximum, minLength, maxLength and default
+type Schema struct {
+	SchemaURI            string             `json:"$schema,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Type                 schemaTypes        `json:"type,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *bool              `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Default              interface{}        `json:"default,omitempty"`
+	// Format 'password' and WriteOnly mark secret keys, which are not echoed in interactive mode
+	Format    string `json:"format,omitempty"`
+	WriteOnly bool   `json:"writeOnly,omitempty"`
+
+	patternRe *regexp.Regexp
+}
+
+// schemaTypes is the type of a schema, given as a name or a list of names
+type schemaTypes []string
+
+func (t *schemaTypes) UnmarshalJSON(b []byte) error {
+	var name string
+	if err := json.Unmarshal(b, &name); err == nil {
+		*t = schemaTypes{name}
+		return nil
+	}
+	var names []string
+	if err := json.Unmarshal(b, &names); err != nil {
+		return fmt.Errorf("type must be a name or a list of names")
+	}
+	*t = names
+	return nil
+}
+
+func (t schemaTypes) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+	return json.Marshal([]string(t))
+}
+
+// SchemaError is a value of the data object that does not match the schema
+type SchemaError struct {
+	Key     string
+	Message string
+}
+
+func (e *SchemaError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Key, e.Message)
+}
+
+// SchemaErrors holds all the values that do not match the schema
+type SchemaErrors []*SchemaError
+
+func (errs SchemaErrors) Error() string {
+	lines := []string{"the data does not match the schema:"}
+	for _, e := range errs {
+		lines = append(lines, "  "+e.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// LoadSchema reads the schema of a JSON or YAML file, or of a http(s) URL
+func LoadSchema(file string) (*Schema, error) {
+	dat, err := readDataSource(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema '%s': %v", file, err)
+	}
+	data, err := parseData(dat, detectFormat(file, LookupFormat("json")), file, false)
+	if err != nil {
+		return nil, err
+	}
+	// decode the object through json to get the struct of the schema
+	dd, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema '%s': %v", file, err)
+	}
+	schema := &Schema{}
+	err = json.Unmarshal(dd, schema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema '%s': %v", file, err)
+	}
+	err = schema.compile("")
+	if err != nil {
+		return nil, fmt.Errorf("wrong schema '%s': %v", file, err)
+	}
+	return schema, nil
+}
+
+var schemaTypeNames = []string{"string", "integer", "number", "boolean", "object", "array", "null"}
+
+// compile checks the types and compiles the patterns of the schema
+func (s *Schema) compile(key string) error {
+	for _, t := range s.Type {
+		known := false
+		for _, name := range schemaTypeNames {
+			known = known || t == name
+		}
+		if !known {
+			return fmt.Errorf("%s: unknown type '%s'", displayKey(key), t)
+		}
+	}
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("%s: wrong pattern: %v", displayKey(key), err)
+		}
+		s.patternRe = re
+	}
+	for name, prop := range s.Properties {
+		if err := prop.compile(key + "." + name); err != nil {
+			return err
+		}
+	}
+	if s.Items != nil {
+		return s.Items.compile(key + "[0]")
+	}
+	return nil
+}
+
+func displayKey(key string) string {
+	if key == "" {
+		return "(root)"
+	}
+	return trimKeyPrefix(key)
+}
+
+// findSchemaFile returns the schema file in the template directories
+// or in the directories of the template files, or "" if not found
+func findSchemaFile(tmplFiles []string) string {
+	for _, file := range tmplFiles {
+		dir := file
+		if fi, err := os.Stat(file); err != nil || !fi.IsDir() {
+			dir = filepath.Dir(file)
+		}
+		path := filepath.Join(dir, schemaFile)
+		if fi, err := os.Stat(path); err == nil && !fi.IsDir() {
+			return path
+		}
+	}
+	return ""
+}
+
+// child returns the schema of the path segment of a key
+func (s *Schema) child(elem string) *Schema {
+	if _, ok := keyIndex(elem); ok {
+		return s.Items
+	}
+	return s.Properties[elem]
+}
+
+// lookup returns the schema of the flattened key, or nil if the schema has none
+func (s *Schema) lookup(key string) *Schema {
+	for _, elem := range splitKey(key) {
+		if s == nil {
+			return nil
+		}
+		s = s.child(elem)
+	}
+	return s
+}
+
+// valueType returns the type of --type for the flattened key, or "" if the schema has none
+func (s *Schema) valueType(key string) string {
+	sub := s.lookup(key)
+	if sub == nil || len(sub.Type) != 1 {
+		return ""
+	}
+	switch sub.Type[0] {
+	case "integer":
+		return "int"
+	case "number":
+		return "float"
+	case "boolean":
+		return "bool"
+	case "object", "array":
+		return "json"
+	}
+	return sub.Type[0]
+}
+
+// applyDefaults sets the defaults of the properties missing from the objects of the value.
+// Missing objects are created if their properties have defaults.
+// The keys set are passed to set
+func (s *Schema) applyDefaults(value interface{}, key string, set func(key string)) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, name := range sortedSchemaKeys(s.Properties) {
+			prop := s.Properties[name]
+			propKey := key + "." + name
+			if _, ok := v[name]; !ok {
+				switch {
+				case prop.Default != nil:
+					v[name] = normalizeValue(copyValue(prop.Default))
+					set(propKey)
+					continue
+				case prop.hasDefaults():
+					v[name] = make(map[string]interface{})
+				default:
+					continue
+				}
+			}
+			prop.applyDefaults(v[name], propKey, set)
+		}
+	case []interface{}:
+		if s.Items == nil {
+			return
+		}
+		for i, elem := range v {
+			s.Items.applyDefaults(elem, fmt.Sprintf("%s[%d]", key, i), set)
+		}
+	}
+}
+
+// hasDefaults reports whether any property of the object schema has a default
+func (s *Schema) hasDefaults() bool {
+	for _, prop := range s.Properties {
+		if prop.Default != nil || prop.hasDefaults() {
+			return true
+		}
+	}
+	return false
+}
+
+func copyValue(value interface{}) interface{} {
+	dd, err := json.Marshal(value)
+	if err != nil {
+		return value
+	}
+	var v interface{}
+	if json.Unmarshal(dd, &v) != nil {
+		return value
+	}
+	return v
+}
+
+func sortedSchemaKeys(m map[string]*Schema) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Validate checks the value against the schema and returns all the mismatches
+// with the flattened keys of the values
+func (s *Schema) Validate(value interface{}) SchemaErrors {
+	errs := SchemaErrors{}
+	s.validate(value, "", &errs)
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+func (s *Schema) validate(value interface{}, key string, errs *SchemaErrors) {
+	fail := func(format string, a ...interface{}) {
+		*errs = append(*errs, &SchemaError{Key: displayKey(key), Message: fmt.Sprintf(format, a...)})
+	}
+	if len(s.Type) > 0 && !s.Type.match(value) {
+		fail("expected %s, got %s", strings.Join(s.Type, " or "), jsonTypeName(value))
+		return
+	}
+	if len(s.Enum) > 0 && !s.inEnum(value) {
+		fail("%s is not one of %s", jsonString(value), jsonString(s.Enum))
+	}
+	switch v := value.(type) {
+	case string:
+		if s.patternRe != nil && !s.patternRe.MatchString(v) {
+			fail("%s does not match the pattern '%s'", jsonString(v), s.Pattern)
+		}
+		length := len([]rune(v))
+		if s.MinLength != nil && length < *s.MinLength {
+			fail("%s is shorter than %d", jsonString(v), *s.MinLength)
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			fail("%s is longer than %d", jsonString(v), *s.MaxLength)
+		}
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				*errs = append(*errs, &SchemaError{Key: displayKey(key + "." + name), Message: "is required"})
+			}
+		}
+		for _, name := range dictKeys(v) {
+			prop, ok := s.Properties[name]
+			if !ok {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					*errs = append(*errs, &SchemaError{Key: displayKey(key + "." + name), Message: "is not allowed"})
+				}
+				continue
+			}
+			prop.validate(v[name], key+"."+name, errs)
+		}
+	case []interface{}:
+		if s.Items != nil {
+			for i, elem := range v {
+				s.Items.validate(elem, fmt.Sprintf("%s[%d]", key, i), errs)
+			}
+		}
+	default:
+		if n, ok := toFloat(value); ok {
+			if s.Minimum != nil && n < *s.Minimum {
+				fail("%v is less than %v", value, *s.Minimum)
+			}
+			if s.Maximum != nil && n > *s.Maximum {
+				fail("%v is greater than %v", value, *s.Maximum)
+			}
+		}
+	}
+}
+
+func (t schemaTypes) match(value interface{}) bool {
+	actual := jsonTypeName(value)
+	for _, name := range t {
+		if name == actual || name == "number" && actual == "integer" {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Schema) inEnum(value interface{}) bool {
+	for _, e := range s.Enum {
+		if reflect.DeepEqual(normalizeValue(e), value) {
+			return true
+		}
+		a, aok := toFloat(e)
+		b, bok := toFloat(value)
+		if aok && bok && a == b {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonTypeName returns the JSON Schema type of the value
+func jsonTypeName(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case float32:
+		return "number"
+	}
+	if _, ok := toFloat(value); ok {
+		return "integer"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+func jsonString(value interface{}) string {
+	dd, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(dd)
+}
+
+// generateSchema returns a starter schema of the data object.
+// Empty strings are required keys and the other values are defaults
+func generateSchema(value interface{}) *Schema {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		s := &Schema{Type: schemaTypes{"object"}, Properties: make(map[string]*Schema)}
+		for _, name := range dictKeys(v) {
+			prop := generateSchema(v[name])
+			s.Properties[name] = prop
+			if prop.Default == nil && !prop.hasDefaults() {
+				s.Required = append(s.Required, name)
+			}
+		}
+		return s
+	case []interface{}:
+		s := &Schema{Type: schemaTypes{"array"}}
+		if len(v) > 0 {
+			s.Items = generateSchema(v[0])
+		}
+		return s
+	case nil:
+		return &Schema{}
+	case string:
+		s := &Schema{Type: schemaTypes{"string"}}
+		if v != "" {
+			s.Default = v
+		}
+		return s
+	}
+	return &Schema{Type: schemaTypes{jsonTypeName(value)}, Default: value}
+}
+
+// marshalSchema writes the starter schema of the data object as JSON
+func marshalSchema(data map[string]interface{}) (string, error) {
+	s := generateSchema(data)
+	s.SchemaURI = "http://json-schema.org/draft-07/schema#"
+	dd, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s\n", string(dd)), nil
+}
@@ -0,0 +1,135 @@
+package tpl
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testSchema = `{
+  "type": "object",
+  "required": ["name", "port"],
+  "additionalProperties": false,
+  "properties": {
+    "name": {"type": "string", "pattern": "^[a-z]+$", "minLength": 2, "maxLength": 5},
+    "port": {"type": "integer", "minimum": 1, "maximum": 65535},
+    "ratio": {"type": "number"},
+    "env": {"enum": ["dev", "prod"]},
+    "debug": {"type": ["boolean", "null"], "default": false},
+    "db": {
+      "type": "object",
+      "properties": {
+        "host": {"type": "string", "default": "localhost"}
+      }
+    },
+    "servers": {"type": "array", "items": {"type": "object", "required": ["host"]}}
+  }
+}`
+
+func loadTestSchema(t *testing.T, text string) (*Schema, error) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, schemaFile)
+	if err := ioutil.WriteFile(file, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return LoadSchema(file)
+}
+
+func TestSchemaValidate(t *testing.T) {
+	s, err := loadTestSchema(t, testSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		data map[string]interface{}
+		want []string
+	}{
+		{"valid", map[string]interface{}{"name": "web", "port": 80, "ratio": 0.5, "env": "dev", "debug": nil}, nil},
+		{"integer as number", map[string]interface{}{"name": "web", "port": 80, "ratio": 1}, nil},
+		{"required", map[string]interface{}{}, []string{"name: is required", "port: is required"}},
+		{"additional", map[string]interface{}{"name": "web", "port": 80, "x": 1}, []string{"x: is not allowed"}},
+		{"type", map[string]interface{}{"name": 1, "port": 1.5}, []string{"name: expected string, got integer", "port: expected integer, got number"}},
+		{"pattern and length", map[string]interface{}{"name": "Webserver", "port": 80}, []string{
+			`name: "Webserver" does not match the pattern '^[a-z]+$'`,
+			`name: "Webserver" is longer than 5`,
+		}},
+		{"minLength", map[string]interface{}{"name": "w", "port": 80}, []string{`name: "w" is shorter than 2`}},
+		{"range", map[string]interface{}{"name": "web", "port": 0}, []string{"port: 0 is less than 1"}},
+		{"maximum", map[string]interface{}{"name": "web", "port": 70000}, []string{"port: 70000 is greater than 65535"}},
+		{"enum", map[string]interface{}{"name": "web", "port": 80, "env": "qa"}, []string{`env: "qa" is not one of ["dev","prod"]`}},
+		{"items", map[string]interface{}{"name": "web", "port": 80, "servers": []interface{}{
+			map[string]interface{}{"host": "a"},
+			map[string]interface{}{},
+		}}, []string{"servers[1].host: is required"}},
+	}
+	for _, tc := range tests {
+		got := []string{}
+		for _, e := range s.Validate(tc.data) {
+			got = append(got, e.Error())
+		}
+		if len(got) == 0 {
+			got = nil
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestSchemaErrors(t *testing.T) {
+	errs := SchemaErrors{{Key: "a", Message: "is required"}, {Key: "b.c", Message: "is not allowed"}}
+	want := "the data does not match the schema:\n  a: is required\n  b.c: is not allowed"
+	if errs.Error() != want {
+		t.Errorf("got %q, want %q", errs.Error(), want)
+	}
+}
+
+func TestLoadSchemaErrors(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{`{"properties": {"a": {"type": "str"}}}`, "a: unknown type 'str'"},
+		{`{"properties": {"a": {"pattern": "("}}}`, "a: wrong pattern"},
+		{`{"items": {"type": "nil"}}`, "[0]: unknown type 'nil'"},
+		{`{"type": 1}`, "type must be a name or a list of names"},
+	}
+	for _, tc := range tests {
+		_, err := loadTestSchema(t, tc.text)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: got error %v, want %s", tc.text, err, tc.want)
+		}
+	}
+}
+
+func TestSchemaApplyDefaults(t *testing.T) {
+	s, err := loadTestSchema(t, testSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := map[string]interface{}{"name": "web", "debug": true}
+	set := []string{}
+	s.applyDefaults(data, "", func(key string) { set = append(set, key) })
+	want := map[string]interface{}{
+		"name":  "web",
+		"debug": true,
+		"db":    map[string]interface{}{"host": "localhost"},
+	}
+	if !reflect.DeepEqual(data, want) {
+		t.Errorf("got %v, want %v", data, want)
+	}
+	if !reflect.DeepEqual(set, []string{".db.host"}) {
+		t.Errorf("set keys %v, want [.db.host]", set)
+	}
+	if got := s.valueType(".port"); got != "int" {
+		t.Errorf("valueType(.port) = %s, want int", got)
+	}
+	if got := s.valueType(".servers[0]"); got != "json" {
+		t.Errorf("valueType(.servers[0]) = %s, want json", got)
+	}
+}
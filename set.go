@@ -0,0 +1,142 @@
+package tpl
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// splitSetValues splits the value of a set option into key=value pairs
+// by the commas that are not escaped with '\' nor in a '{a,b}' list
+func splitSetValues(str string) []string {
+	pairs := []string{}
+	buf := new(strings.Builder)
+	depth := 0
+	for i := 0; i < len(str); i++ {
+		c := str[i]
+		switch {
+		case c == '\\' && i+1 < len(str) && str[i+1] == ',':
+			i++
+			buf.WriteByte(',')
+			continue
+		case c == '{':
+			depth++
+		case c == '}' && depth > 0:
+			depth--
+		case c == ',' && depth == 0:
+			pairs = append(pairs, buf.String())
+			buf.Reset()
+			continue
+		}
+		buf.WriteByte(c)
+	}
+	return append(pairs, buf.String())
+}
+
+// typedValue converts the value of --set to a bool, an integer, null or a '{a,b}' list.
+// The other values are strings
+func typedValue(value string) interface{} {
+	switch value {
+	case "true":
+		return true
+	case "false":
+		return false
+	case "null":
+		return nil
+	}
+	if strings.HasPrefix(value, "{") && strings.HasSuffix(value, "}") {
+		list := []interface{}{}
+		inner := value[1 : len(value)-1]
+		if inner == "" {
+			return list
+		}
+		for _, elem := range splitSetValues(inner) {
+			list = append(list, typedValue(elem))
+		}
+		return list
+	}
+	// keep leading zeros like '007'
+	if len(value) > 1 && strings.HasPrefix(strings.TrimPrefix(value, "-"), "0") {
+		return value
+	}
+	if i, err := strconv.Atoi(value); err == nil {
+		return i
+	}
+	return value
+}
+
+// setValue sets the value to the key like 'a.b[0].c' of the data object,
+// creating objects and lists on the way and replacing the other values.
+// The elements missing before a list index are null
+func setValue(data map[string]interface{}, key string, value interface{}) error {
+	elems := splitKey(appendKeyPrefix(key))
+	if len(elems) == 0 {
+		return fmt.Errorf("empty key")
+	}
+	for _, elem := range elems {
+		if elem == "" {
+			return fmt.Errorf("empty key in '%s'", key)
+		}
+	}
+	data[elems[0]] = setPath(data[elems[0]], elems[1:], value)
+	return nil
+}
+
+// applySetValues sets the values of --set, --set-string and --set-file
+// on top of the data object, in this order.
+// A key of set and set-file can have a type hint like 'replicas:int=3', see ValueTypes
+func (tmpl *Tmpl) applySetValues() error {
+	opts := tmpl.TmplOpts
+	sets := []struct {
+		name   string
+		values []string
+	}{
+		{"set", opts.SetValues},
+		{"set-string", opts.SetStringValues},
+		{"set-file", opts.SetFileValues},
+	}
+	for _, set := range sets {
+		for _, str := range set.values {
+			for _, pair := range splitSetValues(str) {
+				elems := strings.SplitN(pair, "=", 2)
+				if len(elems) != 2 {
+					return fmt.Errorf("wrong %s option '%s': key=value is expected", set.name, pair)
+				}
+				key, typ := strings.TrimSpace(elems[0]), ""
+				var err error
+				// the values of set-string are always strings, even with a ':' in the key
+				if set.name != "set-string" {
+					key, typ, err = splitTypeHint(key)
+					if err != nil {
+						return fmt.Errorf("wrong %s option '%s': %v", set.name, pair, err)
+					}
+				}
+				raw := elems[1]
+				if set.name == "set-file" {
+					dat, err := ioutil.ReadFile(raw)
+					if err != nil {
+						return fmt.Errorf("failed to read set-file '%s': %v", raw, err)
+					}
+					raw = string(dat)
+				}
+				var value interface{} = raw
+				switch {
+				case typ != "":
+					value, err = convertValue(raw, typ)
+					if err != nil {
+						return fmt.Errorf("wrong %s option '%s': %v", set.name, pair, err)
+					}
+				case set.name == "set":
+					value = typedValue(raw)
+				}
+				err = setValue(tmpl.Data, key, value)
+				if err != nil {
+					return fmt.Errorf("wrong %s option '%s': %v", set.name, pair, err)
+				}
+				tmpl.merger.setOrigin(appendKeyPrefix(key), "--"+set.name)
+			}
+		}
+	}
+	return nil
+}
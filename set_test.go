@@ -0,0 +1,133 @@
+package tpl
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitSetValues(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"a=1", []string{"a=1"}},
+		{"a=1,b=2", []string{"a=1", "b=2"}},
+		{`a=x\,y,b=2`, []string{"a=x,y", "b=2"}},
+		{"a={x,y},b=2", []string{"a={x,y}", "b=2"}},
+		{"a={x,{y,z}}", []string{"a={x,{y,z}}"}},
+	}
+	for _, tc := range tests {
+		if got := splitSetValues(tc.text); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("splitSetValues(%q) = %q, want %q", tc.text, got, tc.want)
+		}
+	}
+}
+
+func TestTypedValue(t *testing.T) {
+	tests := []struct {
+		text string
+		want interface{}
+	}{
+		{"x", "x"},
+		{"3", 3},
+		{"-3", -3},
+		{"007", "007"},
+		{"0", 0},
+		{"1.5", "1.5"},
+		{"true", true},
+		{"false", false},
+		{"null", nil},
+		{"{}", []interface{}{}},
+		{"{a,1,true}", []interface{}{"a", 1, true}},
+	}
+	for _, tc := range tests {
+		if got := typedValue(tc.text); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("typedValue(%q) = %#v, want %#v", tc.text, got, tc.want)
+		}
+	}
+}
+
+func TestApplySetValues(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	cert := filepath.Join(dir, "cert.pem")
+	if err := ioutil.WriteFile(cert, []byte("CERT\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	port := filepath.Join(dir, "port")
+	if err := ioutil.WriteFile(port, []byte("8080"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		set       []string
+		setString []string
+		setFile   []string
+		want      map[string]interface{}
+	}{
+		{"set", []string{"a.b=c,n=3,on=true"}, nil, nil,
+			map[string]interface{}{"a": map[string]interface{}{"b": "c"}, "n": 3, "on": true}},
+		{"list index", []string{"s[1].host=db2"}, nil, nil,
+			map[string]interface{}{"s": []interface{}{nil, map[string]interface{}{"host": "db2"}}}},
+		{"list value", []string{"tags={a,b}"}, nil, nil,
+			map[string]interface{}{"tags": []interface{}{"a", "b"}}},
+		{"hint", []string{"v:string=010,r:float=2,x:json={\"k\":1}"}, nil, nil,
+			map[string]interface{}{"v": "010", "r": 2.0, "x": map[string]interface{}{"k": 1.0}}},
+		{"set-string", nil, []string{"n=3,on=true"}, nil,
+			map[string]interface{}{"n": "3", "on": "true"}},
+		{"set-string without hints", nil, []string{"a:int=3"}, nil,
+			map[string]interface{}{"a:int": "3"}},
+		{"set-file", nil, nil, []string{"tls.cert=" + cert},
+			map[string]interface{}{"tls": map[string]interface{}{"cert": "CERT\n"}}},
+		{"set-file hint", nil, nil, []string{"port:int=" + port},
+			map[string]interface{}{"port": 8080}},
+		{"order", []string{"a=1"}, []string{"a=2"}, nil,
+			map[string]interface{}{"a": "2"}},
+	}
+	for _, tc := range tests {
+		tmpl := &Tmpl{
+			TmplOpts: &TmplOpts{SetValues: tc.set, SetStringValues: tc.setString, SetFileValues: tc.setFile},
+			Data:     make(map[string]interface{}),
+			merger:   newDataMerger(""),
+		}
+		if err := tmpl.applySetValues(); err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if got := tmpl.Data; !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %#v, want %#v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestApplySetValuesErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		set       []string
+		setString []string
+		setFile   []string
+		want      string
+	}{
+		{"no value", []string{"a"}, nil, nil, "wrong set option 'a': key=value is expected"},
+		{"invalid hint", []string{"a:number=1"}, nil, nil, "wrong set option 'a:number=1': type 'number' is not one of"},
+		{"wrong value", []string{"a:int=x"}, nil, nil, "wrong set option 'a:int=x': 'x' is not an int"},
+		{"empty key", []string{"a..b=1"}, nil, nil, "wrong set option 'a..b=1': empty key"},
+		{"set-string no value", nil, []string{"a"}, nil, "wrong set-string option 'a': key=value is expected"},
+		{"missing file", nil, nil, []string{"a=/nonexistent/tpl"}, "failed to read set-file '/nonexistent/tpl'"},
+	}
+	for _, tc := range tests {
+		tmpl := &Tmpl{
+			TmplOpts: &TmplOpts{SetValues: tc.set, SetStringValues: tc.setString, SetFileValues: tc.setFile},
+			Data:     make(map[string]interface{}),
+			merger:   newDataMerger(""),
+		}
+		err := tmpl.applySetValues()
+		if err == nil || !strings.HasPrefix(err.Error(), tc.want) {
+			t.Errorf("%s: got error %v, want %s", tc.name, err, tc.want)
+		}
+	}
+}
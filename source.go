@@ -0,0 +1,206 @@
+package tpl
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// DataSource provides a data object merged into the data of Tmpl
+type DataSource interface {
+	// Name is reported as the source of the keys of the data object
+	Name() string
+	// Load returns the data object.
+	// The data loaded from the previous sources is in tmpl.Data
+	Load(tmpl *Tmpl) (map[string]interface{}, error)
+}
+
+// FileSource reads a data file or a http(s) URL.
+// Format is used if the format can not be found from the extension
+type FileSource struct {
+	Path   string
+	Format string
+}
+
+// Name returns the path of the file
+func (s *FileSource) Name() string {
+	return s.Path
+}
+
+// Load reads and parses the file
+func (s *FileSource) Load(tmpl *Tmpl) (map[string]interface{}, error) {
+	dat, err := readDataSource(s.Path)
+	if err != nil {
+		return nil, err
+	}
+	return parseData(dat, detectFormat(s.Path, lookupFormatOrYaml(s.Format)), s.Path, tmpl.TmplOpts.InferTypes)
+}
+
+// StdinSource reads a data object from the reader, or from stdin if Reader is nil.
+// The format is sniffed from the data if Format is empty
+type StdinSource struct {
+	Reader io.Reader
+	Format string
+}
+
+// Name returns 'stdin'
+func (s *StdinSource) Name() string {
+	return "stdin"
+}
+
+// Load reads and parses the data
+func (s *StdinSource) Load(tmpl *Tmpl) (map[string]interface{}, error) {
+	r := s.Reader
+	if r == nil {
+		r = os.Stdin
+	}
+	dat, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return parseSniffedData(dat, s.Format, s.Name(), tmpl.TmplOpts.InferTypes)
+}
+
+// MapSource provides the data object built by the program
+type MapSource struct {
+	Label string
+	Data  map[string]interface{}
+}
+
+// Name returns the label of the data
+func (s *MapSource) Name() string {
+	return s.Label
+}
+
+// Load returns a copy of the data object
+func (s *MapSource) Load(tmpl *Tmpl) (map[string]interface{}, error) {
+	return normalizeValue(s.Data).(map[string]interface{}), nil
+}
+
+// CommandSource runs the command and parses its output.
+// The format is sniffed from the output if Format is empty
+type CommandSource struct {
+	Command string
+	Args    []string
+	Format  string
+}
+
+// Name returns the command line
+func (s *CommandSource) Name() string {
+	return strings.Join(append([]string{s.Command}, s.Args...), " ")
+}
+
+// Load runs the command and parses its output
+func (s *CommandSource) Load(tmpl *Tmpl) (map[string]interface{}, error) {
+	cmd := exec.Command(s.Command, s.Args...)
+	stderr := new(bytes.Buffer)
+	cmd.Stderr = stderr
+	dat, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run '%s': %v: %s", s.Name(), err, strings.TrimSpace(stderr.String()))
+	}
+	return parseSniffedData(dat, s.Format, s.Name(), tmpl.TmplOpts.InferTypes)
+}
+
+// overlay is implemented by the data sources merged by key and list index
+// regardless of the merge strategy. precedence returns one of EnvPrecedences
+type overlay interface {
+	precedence() string
+}
+
+// EnvSource loads the environment variables whose names are keys of the templates.
+// By default only the keys without values are set, see Precedence.
+// The values are converted to the types of the type options, or inferred with the infer-types option.
+// With Prefix, the variables are loaded under the dot separated key of the prefix like 'app.redis'
+type EnvSource struct {
+	Prefix string
+	// Precedence is one of EnvPrecedences, EnvPrecedenceGaps if empty
+	Precedence string
+	// Separator separates the segments of the keys in the names, like '__' for 'DB__HOST'.
+	// The names are the keys as they are if empty
+	Separator string
+	// Case is one of EnvCases, EnvCaseExact if empty
+	Case string
+	// StripPrefix is the prefix of the names like 'APP_'. The other variables are not loaded
+	StripPrefix string
+}
+
+// Name returns 'env'
+func (s *EnvSource) Name() string {
+	return "env"
+}
+
+func (s *EnvSource) precedence() string {
+	if s.Precedence == "" {
+		return EnvPrecedenceGaps
+	}
+	return s.Precedence
+}
+
+// Load returns the environment variables used by the templates
+func (s *EnvSource) Load(tmpl *Tmpl) (map[string]interface{}, error) {
+	keys, err := tmpl.templateKeys()
+	if err != nil {
+		return nil, err
+	}
+	prefix := ""
+	if s.Prefix != "" {
+		prefix = appendKeyPrefix(s.Prefix)
+	}
+	matchers := s.envMatchers(keys, prefix)
+	env := os.Environ()
+	sort.Strings(env)
+	data := make(map[string]interface{})
+	for _, e := range env {
+		elems := strings.SplitN(e, "=", 2)
+		if len(elems) != 2 {
+			continue
+		}
+		key, ok := s.envKey(elems[0], prefix, matchers)
+		if !ok {
+			continue
+		}
+		if !s.sets(tmpl.Data, key) {
+			continue
+		}
+		value, err := tmpl.coerceValue(key, elems[1])
+		if err != nil {
+			return nil, fmt.Errorf("wrong value of env '%s': %v", elems[0], err)
+		}
+		setValue(data, key, value)
+	}
+	return data, nil
+}
+
+// sets reports whether the variable of the key is set to the data by the precedence
+func (s *EnvSource) sets(data map[string]interface{}, key string) bool {
+	value, ok := lookupKey(data, key)
+	switch s.precedence() {
+	case EnvPrecedenceEnv:
+		return true
+	case EnvPrecedenceFile:
+		return !ok
+	}
+	return value == nil
+}
+
+func lookupFormatOrYaml(name string) *Format {
+	if format := LookupFormat(name); format != nil {
+		return format
+	}
+	return LookupFormat("yaml")
+}
+
+// parseSniffedData parses the data of the format, or of the format sniffed from the data
+func parseSniffedData(dat []byte, format string, name string, infer bool) (map[string]interface{}, error) {
+	f := LookupFormat(format)
+	if f == nil {
+		f = lookupFormatOrYaml(sniffDataFormat(dat))
+	}
+	return parseData(dat, f, name, infer)
+}
@@ -1,22 +1,21 @@
 package tpl
 
 import (
-	"bufio"
 	"bytes"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
+	"text/tabwriter"
 	"text/template"
 
-	"github.com/imdario/mergo"
 	"github.com/spf13/viper"
-	ini "github.com/vaughan0/go-ini"
-	"gopkg.in/yaml.v2"
 )
 
 // TmplOpts holds options to execute template
@@ -24,14 +23,39 @@ type TmplOpts struct {
 	DataFilesStr       string
 	DataFiles          []string
 	DataFormat         string
+	Merge              string
+	SetValues          []string
+	SetStringValues    []string
+	SetFileValues      []string
+	InferTypes         bool
+	Types              []string
+	Schema             string
 	TmplFiles          []string
+	IncludesStr        string
+	Includes           []string
+	MatchStr           string
+	ExcludeStr         string
+	ModeStr            string
+	Mode               os.FileMode
+	Atomic             bool
+	DryRun             bool
 	Output             string
 	OutDir             string
 	OutExt             string
 	MissingKey         string
 	Interactive        bool
+	Form               bool
+	Answers            string
+	NoTTY              bool
 	UseEnv             bool
 	UseEnvFromPrefix   string
+	EnvSeparator       string
+	EnvCase            string
+	EnvStripPrefix     string
+	EnvPrecedence      string
+	FileRoot           string
+	AllowExec          bool
+	Deps               bool
 	DataOutFile        string
 	DataOutFormat      string
 	FoldContext        bool
@@ -42,58 +66,79 @@ type TmplOpts struct {
 
 // Tmpl contains metadata
 type Tmpl struct {
-	Re       *regexp.Regexp
-	TmplOpts *TmplOpts
-	Data     map[string]interface{}
-	Files    []*TmplFileMeta
+	TmplOpts  *TmplOpts
+	Data      map[string]interface{}
+	Files     []*TmplFileMeta
+	CopyFiles []string
+	Sources   []DataSource
+	// Out receives processed templates, diffs and data objects. Stdout is used if nil
+	Out io.Writer
+	// Colors colours the info of processed files and the prompts. The colours of the config are used if nil
+	Colors *NavColorMeta
+	// Prompter asks for missing keys and overwriting files. Stdin is used if nil,
+	// and nothing is asked with the no-tty option
+	Prompter Prompter
+	// Schema validates the data and gives the defaults and the types of the keys
+	Schema   *Schema
+	relPaths map[string]string
+	texts    map[string]string
+	merger   *dataMerger
+	types    map[string]string
+	// inputs are the fields of the keys input in interactive mode
+	inputs map[string]*Field
 }
 
 // TmplFileMeta holds information about template file
 type TmplFileMeta struct {
-	Name     string
-	OrigPath string
-	DestPath string
-	Mode     os.FileMode
-	Content  string
-	Changed  bool
+	Name        string
+	OrigPath    string
+	RelPath     string
+	InDir       bool
+	DestPath    string
+	Mode        os.FileMode
+	Content     string
+	Changed     bool
+	Exists      bool
+	DestMode    os.FileMode
+	DestContent string
+}
+
+// Status returns whether the file at the destination path is created, modified or unchanged
+func (tfm *TmplFileMeta) Status() string {
+	switch {
+	case !tfm.Exists:
+		return "created"
+	case tfm.Changed:
+		return "modified"
+	}
+	return "unchanged"
 }
 
 // LineMeta holds metadata specific to the line
 type LineMeta struct {
-	Line         string
-	ReplacedLine string
-	Space        int
-	NoValue      bool
+	Line  string
+	Space int
 }
 
 const (
-	missingKeyError   = "missingkey=error"
-	missingKeyDefault = "missingkey=default"
+	missingKeyError = "error"
 )
 
 func getFileExt(file string) string {
 	return strings.TrimPrefix(filepath.Ext(file), ".")
 }
 
-// OptsToTmpl creates a Tmpl object from TmplOpts
+// OptsToTmpl creates a Tmpl object from TmplOpts, using the config of viper
+// for the options not given, and loads the data of the data files and the environment
 func (opts *TmplOpts) OptsToTmpl() (Tmpl, error) {
-	tmpl := Tmpl{TmplOpts: opts}
-
-	// Check options
-	missingKey := strings.ToLower(opts.MissingKey)
-	if missingKey == "" {
-		missingKey = "error"
-	}
-	if missingKey != "error" && missingKey != "zero" && missingKey != "default" && missingKey != "invalid" {
-		return tmpl, fmt.Errorf("wrong missing key option")
-	}
-	opts.MissingKey = missingKey
-
 	useEnv := viper.Get("tpl.env")
 	foldContext := viper.Get("tpl.fold-context")
 	interactive := viper.Get("tpl.interactive")
 	overwrite := viper.Get("tpl.overwrite")
 	showProcessedFile := viper.Get("tpl.show-processed-info")
+	inferTypes := viper.Get("tpl.infer-types")
+	form := viper.Get("tpl.form")
+	noTTY := viper.Get("tpl.no-tty")
 	if useEnv != nil && !opts.UseEnv {
 		opts.UseEnv = viper.GetBool("tpl.env")
 	}
@@ -109,154 +154,296 @@ func (opts *TmplOpts) OptsToTmpl() (Tmpl, error) {
 	if showProcessedFile != nil && !opts.ShowProcessedFile {
 		opts.ShowProcessedFile = viper.GetBool("tpl.show-processed-info")
 	}
+	if inferTypes != nil && !opts.InferTypes {
+		opts.InferTypes = viper.GetBool("tpl.infer-types")
+	}
+	if form != nil && !opts.Form {
+		opts.Form = viper.GetBool("tpl.form")
+	}
+	if noTTY != nil && !opts.NoTTY {
+		opts.NoTTY = viper.GetBool("tpl.no-tty")
+	}
+	if opts.Form || opts.Answers != "" || opts.NoTTY {
+		opts.Interactive = true
+	}
+	if opts.IncludesStr == "" {
+		opts.IncludesStr = viper.GetString("tpl.include")
+	}
+	if opts.Merge == "" {
+		opts.Merge = viper.GetString("tpl.merge")
+	}
+	if opts.Schema == "" {
+		opts.Schema = viper.GetString("tpl.schema")
+	}
+	if opts.EnvSeparator == "" {
+		opts.EnvSeparator = viper.GetString("tpl.env-separator")
+	}
+	if opts.EnvCase == "" {
+		opts.EnvCase = viper.GetString("tpl.env-case")
+	}
+	if opts.EnvStripPrefix == "" {
+		opts.EnvStripPrefix = viper.GetString("tpl.env-strip-prefix")
+	}
+	if opts.EnvPrecedence == "" {
+		opts.EnvPrecedence = viper.GetString("tpl.env-precedence")
+	}
+	if opts.FileRoot == "" {
+		opts.FileRoot = viper.GetString("tpl.file-root")
+	}
 
-	// data files separator: space vs colon
-	//opts.DataFiles = strings.Fields(opts.DataFilesStr)
-	dataFilesElem := make(map[string]bool)
-	dataFiles := []string{}
-	if opts.DataFilesStr != "" {
-		dataFiles = strings.Split(opts.DataFilesStr, ":")
+	tmpl, err := NewTmpl(opts)
+	if err != nil {
+		return Tmpl{TmplOpts: opts}, err
 	}
-	for _, v := range dataFiles {
-		matches, err := filepath.Glob(v)
+	sources, err := opts.dataSources()
+	if err != nil {
+		return *tmpl, err
+	}
+	tmpl.Sources = append(tmpl.Sources, sources...)
+	err = tmpl.LoadData()
+	return *tmpl, err
+}
+
+// NewTmpl creates a Tmpl object from TmplOpts without loading data.
+// Templates and data sources can be added before loading the data with LoadData
+func NewTmpl(opts *TmplOpts) (*Tmpl, error) {
+	if opts == nil {
+		opts = &TmplOpts{}
+	}
+	tmpl := &Tmpl{TmplOpts: opts, Data: make(map[string]interface{})}
+
+	// Check options
+	missingKey := strings.ToLower(opts.MissingKey)
+	if missingKey == "" {
+		missingKey = "error"
+	}
+	if missingKey != "error" && missingKey != "zero" && missingKey != "default" && missingKey != "invalid" {
+		return tmpl, fmt.Errorf("wrong missing key option")
+	}
+	opts.MissingKey = missingKey
+
+	if opts.ModeStr != "" {
+		mode, err := parseFileMode(opts.ModeStr)
 		if err != nil {
-			return tmpl, fmt.Errorf("datafile glob error: %v", err)
-		}
-		for _, match := range matches {
-			_, ok := dataFilesElem[match]
-			if !ok {
-				dataFilesElem[match] = true
-			}
+			return tmpl, fmt.Errorf("wrong mode option: %v", err)
 		}
+		opts.Mode = mode
 	}
-	for k := range dataFilesElem {
-		opts.DataFiles = append(opts.DataFiles, k)
+	if opts.Merge != "" && !validMergeStrategy(opts.Merge) {
+		return tmpl, fmt.Errorf("wrong merge option: '%s' is not one of %s", opts.Merge, strings.Join(MergeStrategies, ", "))
 	}
-	defaultDataFormat := "yaml"
-	switch opts.DataFormat {
-	case "json", "yml", "yaml", "ini", "kv":
-		defaultDataFormat = opts.DataFormat
+	if opts.EnvCase != "" && !validEnvCase(opts.EnvCase) {
+		return tmpl, fmt.Errorf("wrong env-case option: '%s' is not one of %s", opts.EnvCase, strings.Join(EnvCases, ", "))
 	}
-	// DataFiles to Data object
-	datakv := make(map[string]interface{})
-	for _, file := range opts.DataFiles {
-		dat, err := ioutil.ReadFile(file)
+	if opts.EnvPrecedence != "" && !validEnvPrecedence(opts.EnvPrecedence) {
+		return tmpl, fmt.Errorf("wrong env-precedence option: '%s' is not one of %s", opts.EnvPrecedence, strings.Join(EnvPrecedences, ", "))
+	}
+	types, err := parseTypes(opts.Types)
+	if err != nil {
+		return tmpl, err
+	}
+	tmpl.types = types
+
+	// the schema option, or the schema file next to the templates
+	schema := opts.Schema
+	if schema == "" {
+		schema = findSchemaFile(opts.TmplFiles)
+	}
+	if schema != "" {
+		tmpl.Schema, err = LoadSchema(schema)
 		if err != nil {
 			return tmpl, err
 		}
-		//var kv map[string]interface{}
-		kv := make(map[string]interface{})
-		ext := getFileExt(file)
-		switch ext {
-		case "json", "yml", "yaml", "ini", "kv":
-		default:
-			ext = defaultDataFormat
-		}
-		switch ext {
-		case "yml", "yaml":
-			err = yaml.Unmarshal(dat, &kv)
-			if err != nil {
-				return tmpl, fmt.Errorf("failed to parse yaml data file '%s': %v", file, err)
-			}
-		case "json":
-			err = json.Unmarshal(dat, &kv)
-			if err != nil {
-				return tmpl, fmt.Errorf("failed to parse json data file '%s': %v", file, err)
+	}
+
+	// partial templates parsed into every template
+	includes, err := globIncludes(opts.IncludesStr)
+	if err != nil {
+		return tmpl, err
+	}
+
+	// walk template directories
+	tmpl.relPaths = make(map[string]string)
+	tmplFiles := []string{}
+	for _, file := range opts.TmplFiles {
+		fi, err := os.Stat(file)
+		if err != nil {
+			return tmpl, err
+		}
+		if !fi.IsDir() {
+			tmplFiles = append(tmplFiles, file)
+			continue
+		}
+		dirFiles, err := WalkTmplDir(file, splitGlobs(opts.MatchStr), splitGlobs(opts.ExcludeStr))
+		if err != nil {
+			return tmpl, fmt.Errorf("failed to walk template directory '%s': %v", file, err)
+		}
+		for _, partial := range dirFiles.Partials {
+			if !includes.has(partial) {
+				includes = append(includes, partial)
 			}
-		case "ini":
-			inifile, err := ini.Load(bytes.NewReader(dat))
+		}
+		for _, f := range append(dirFiles.TmplFiles, dirFiles.CopyFiles...) {
+			rel, err := filepath.Rel(file, f)
 			if err != nil {
-				return tmpl, fmt.Errorf("failed to parse ini data file '%s': %v", file, err)
+				return tmpl, err
 			}
-			for name, section := range inifile {
-				kv[name] = section
+			tmpl.relPaths[f] = rel
+		}
+		tmplFiles = append(tmplFiles, dirFiles.TmplFiles...)
+		tmpl.CopyFiles = append(tmpl.CopyFiles, dirFiles.CopyFiles...)
+	}
+	opts.Includes = includes
+	opts.TmplFiles = []string{}
+	for _, file := range tmplFiles {
+		if !includes.has(file) {
+			opts.TmplFiles = append(opts.TmplFiles, file)
+		}
+	}
+	return tmpl, nil
+}
+
+// dataSources returns the sources of the data files and the environment variables
+func (opts *TmplOpts) dataSources() ([]DataSource, error) {
+	// data files separator: space vs colon
+	//opts.DataFiles = strings.Fields(opts.DataFilesStr)
+	// keep the order of the data files to merge them in the order listed
+	for _, v := range splitDataFiles(opts.DataFilesStr) {
+		if v == stdinDataFile || isURL(v) {
+			if !fileSet(opts.DataFiles).has(v) {
+				opts.DataFiles = append(opts.DataFiles, v)
 			}
-		case "kv":
-			// parse key=value format
-			tmpKv := make(map[string]interface{})
-			scanner := bufio.NewScanner(strings.NewReader(string(dat)))
-			for scanner.Scan() {
-				line := scanner.Text()
-				elems := strings.Split(line, "=")
-				if len(elems) <= 1 {
-					fmt.Printf("warn: datafile is neither yaml nor key=value format\n")
-					continue
-				}
-				tmpKv[appendKeyPrefix(elems[0])] = strings.TrimSpace(elems[1])
+			continue
+		}
+		matches, err := filepath.Glob(v)
+		if err != nil {
+			return nil, fmt.Errorf("datafile glob error: %v", err)
+		}
+		for _, match := range matches {
+			if !fileSet(opts.DataFiles).has(match) {
+				opts.DataFiles = append(opts.DataFiles, match)
 			}
-			kv = expand(tmpKv)
 		}
-		mergo.Merge(&datakv, kv)
 	}
-	tmpl.Data = datakv
-	tmpl.TmplOpts = opts
-	tmpl.Re = regexp.MustCompile(`{{[\s]*(\..*?)[\s]*}}`)
+	if fileSet(opts.DataFiles).has(stdinDataFile) && opts.Interactive && !opts.NoTTY {
+		return nil, fmt.Errorf("stdin can not be used for both datafile and interactive mode")
+	}
+	sources := []DataSource{}
+	for _, file := range opts.DataFiles {
+		if file == stdinDataFile {
+			sources = append(sources, &StdinSource{Format: opts.DataFormat})
+			continue
+		}
+		sources = append(sources, &FileSource{Path: file, Format: opts.DataFormat})
+	}
 	if opts.UseEnv || opts.UseEnvFromPrefix != "" {
-		tmpDataOutFormat := tmpl.TmplOpts.DataOutFormat
-		tmpl.TmplOpts.DataOutFormat = "kv"
-		keysStr, err := tmpl.ExtractKeys()
-		tmpl.TmplOpts.DataOutFormat = tmpDataOutFormat
+		sources = append(sources, &EnvSource{
+			Prefix:      opts.UseEnvFromPrefix,
+			Separator:   opts.EnvSeparator,
+			Case:        opts.EnvCase,
+			StripPrefix: opts.EnvStripPrefix,
+			Precedence:  opts.EnvPrecedence,
+		})
+	}
+	if opts.Answers != "" {
+		sources = append(sources, &AnswersSource{Path: opts.Answers})
+	}
+	return sources, nil
+}
+
+// AddSource adds the data source to be loaded after the other sources
+func (tmpl *Tmpl) AddSource(source DataSource) {
+	tmpl.Sources = append(tmpl.Sources, source)
+}
+
+// LoadData merges the data objects of the sources in order by the merge strategy,
+// sets the defaults of the schema for the keys without values,
+// converts the values of the keys of the type options
+// and sets the values of the set options on top of them
+func (tmpl *Tmpl) LoadData() error {
+	tmpl.Data = make(map[string]interface{})
+	tmpl.merger = newDataMerger(tmpl.TmplOpts.Merge)
+	for _, source := range tmpl.Sources {
+		kv, err := source.Load(tmpl)
 		if err != nil {
-			return tmpl, err
+			return err
 		}
-		keyScanner := bufio.NewScanner(strings.NewReader(keysStr))
-		keys := make(map[string]bool)
-		for keyScanner.Scan() {
-			keys[strings.SplitN(keyScanner.Text(), "=", 2)[0]] = true
-			//keys[appendKeyPrefix(strings.SplitN(keyScanner.Text(), "=", 2)[0])] = true
-		}
-
-		envPrefix := opts.UseEnvFromPrefix
-		if opts.UseEnvFromPrefix != "" {
-			envPrefix = opts.UseEnvFromPrefix + "."
-		}
-		envs := os.Environ()
-		if envPrefix == "" {
-			for _, e := range envs {
-				elems := strings.Split(e, "=")
-				if len(elems) >= 1 {
-					_, ok := datakv[elems[0]]
-					if !ok {
-						_, ok = keys[elems[0]]
-						if ok {
-							datakv[elems[0]] = elems[1]
-						}
-					}
-				}
-			}
-		} else {
-			for _, e := range envs {
-				elems := strings.Split(e, "=")
-				if len(elems) >= 1 {
-					_, ok := keys[envPrefix+elems[0]]
-					if ok {
-						if datakv[opts.UseEnvFromPrefix] == nil {
-							datakv[opts.UseEnvFromPrefix] = make(map[interface{}]interface{})
-						}
-						i, ok := datakv[opts.UseEnvFromPrefix].(map[interface{}]interface{})
-						if ok {
-							_, ok = i[elems[0]]
-							if !ok {
-								i[elems[0]] = elems[1]
-							}
-						} else {
-							i2, ok := datakv[opts.UseEnvFromPrefix].(map[string]interface{})
-							if ok {
-								_, ok = i2[elems[0]]
-								if !ok {
-									i2[elems[0]] = elems[1]
-								}
-							} else {
-								return tmpl, fmt.Errorf("env prefix is already used for data key")
-							}
-
-						}
-					}
-				}
-			}
+		if o, ok := source.(overlay); ok {
+			tmpl.Data = tmpl.merger.fill(tmpl.Data, normalizeValue(kv), source.Name(), "", o.precedence()).(map[string]interface{})
+			continue
+		}
+		err = tmpl.merger.merge(tmpl.Data, normalizeValue(kv).(map[string]interface{}), source.Name(), "")
+		if err != nil {
+			return err
 		}
 	}
-	return tmpl, nil
+	if tmpl.Schema != nil {
+		tmpl.Schema.applyDefaults(tmpl.Data, "", func(key string) {
+			tmpl.merger.setOrigin(key, "schema")
+		})
+	}
+	err := tmpl.applyTypes()
+	if err != nil {
+		return err
+	}
+	return tmpl.applySetValues()
+}
+
+// AddTemplate adds a template of the text. The name is used as the file name of the template
+func (tmpl *Tmpl) AddTemplate(name string, text string) {
+	tmpl.addText(name, text)
+	tmpl.TmplOpts.TmplFiles = append(tmpl.TmplOpts.TmplFiles, name)
+}
+
+// AddPartial adds a partial template of the text parsed into every template
+func (tmpl *Tmpl) AddPartial(name string, text string) {
+	tmpl.addText(name, text)
+	tmpl.TmplOpts.Includes = append(tmpl.TmplOpts.Includes, name)
+}
+
+func (tmpl *Tmpl) addText(name string, text string) {
+	if tmpl.texts == nil {
+		tmpl.texts = make(map[string]string)
+	}
+	tmpl.texts[name] = text
+}
+
+// readTmplFile returns the text added by AddTemplate or AddPartial, or reads the file
+func (tmpl *Tmpl) readTmplFile(file string) ([]byte, error) {
+	if text, ok := tmpl.texts[file]; ok {
+		return []byte(text), nil
+	}
+	return ioutil.ReadFile(file)
+}
+
+// tmplFileMode returns the mode of the template file, or 0 for a text added by AddTemplate
+func (tmpl *Tmpl) tmplFileMode(file string) (os.FileMode, error) {
+	if _, ok := tmpl.texts[file]; ok {
+		return 0, nil
+	}
+	fileinfo, err := os.Stat(file)
+	if err != nil {
+		return 0, err
+	}
+	return fileinfo.Mode(), nil
+}
+
+// templateKeys returns the flattened keys referenced by the templates.
+// The elements of the lists a template ranges over are walked as the first one,
+// so the keys should be looked up with firstIndexKey
+func (tmpl *Tmpl) templateKeys() (map[string]bool, error) {
+	dataFlattenMap := make(map[string]interface{})
+	for _, file := range append(tmpl.TmplOpts.TmplFiles, tmpl.CopyFiles...) {
+		err := tmpl.Keys(file, dataFlattenMap)
+		if err != nil {
+			return nil, err
+		}
+	}
+	keys := make(map[string]bool)
+	for key := range dataFlattenMap {
+		keys[key] = true
+	}
+	return keys, nil
 }
 
 func appendKeyPrefix(text string) string {
@@ -270,52 +457,169 @@ func trimKeyPrefix(text string) string {
 	return strings.TrimPrefix(text, ".")
 }
 
-// Ensure no missing keys in the template file
+// parseTemplate parses the template file with the built-in functions.
+// The include files are parsed first so that the template can call their templates
+func (tmpl *Tmpl) parseTemplate(file string) (*template.Template, *tmplTrees, error) {
+	dat, err := tmpl.readTmplFile(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	if tmpl.isCopyFile(file) {
+		// only the output path is a template
+		dat = nil
+	}
+	return tmpl.parseText(file, string(dat))
+}
+
+// parseText parses the template text of the file with the includes and its front matter
+func (tmpl *Tmpl) parseText(file string, dat string) (*template.Template, *tmplTrees, error) {
+	t := template.New(path.Base(file)).Funcs(tmpl.funcMap())
+	texts := make(map[string]string)
+	for _, include := range tmpl.TmplOpts.Includes {
+		if include == file {
+			continue
+		}
+		dat, err := tmpl.readTmplFile(include)
+		if err != nil {
+			return nil, nil, err
+		}
+		name := path.Base(include)
+		_, err = t.New(name).Parse(string(dat))
+		if err != nil {
+			return nil, nil, err
+		}
+		texts[name] = string(dat)
+	}
+	fm, text, err := parseFrontMatter(dat)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse front matter of '%s': %v", file, err)
+	}
+	_, err = t.Parse(text)
+	if err != nil {
+		return nil, nil, err
+	}
+	texts[t.Name()] = text
+	tt := newTmplTrees(t, texts)
+	tt.frontMatter = fm
+	return t, tt, nil
+}
+
+// fillGuardedKeys sets nil to the missing keys given to 'default' or 'required'
+// so that the functions get the value instead of failing with missingkey=error
+func fillGuardedKeys(data map[string]interface{}, refs []*KeyRef) map[string]interface{} {
+	dataFlattenMap := make(map[string]interface{})
+	nestedToFlattenMap(data, dataFlattenMap, "", false)
+	filled := false
+	for _, ref := range refs {
+		if ref.Guarded() && !hasKey(data, dataFlattenMap, ref.Key) {
+			dataFlattenMap[ref.Key] = nil
+			filled = true
+		}
+	}
+	if !filled {
+		return data
+	}
+	return expand(dataFlattenMap)
+}
+
+// outPath returns the path of the file in the outdir,
+// which is relative to the template directory if the file is found in it
+func (tmpl *Tmpl) outPath(file string) string {
+	if rel, ok := tmpl.relPaths[file]; ok {
+		return rel
+	}
+	return file
+}
+
+// parsePath parses the output path of the file as a template,
+// so that path segments like '{{.service.name}}' are filled from the data
+func (tmpl *Tmpl) parsePath(file string) (*template.Template, *tmplTrees, error) {
+	p := tmpl.outPath(file)
+	name := p + " (path)"
+	t, err := template.New(name).Funcs(tmpl.funcMap()).Parse(p)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error parsing path template: %v", err)
+	}
+	return t, newTmplTrees(t, map[string]string{name: p}), nil
+}
+
+// fileKeys returns the leaf keys of the output path and the template
+func fileKeys(tt *tmplTrees, ptt *tmplTrees) []*KeyRef {
+	for name, text := range ptt.texts {
+		tt.texts[name] = text
+	}
+	return leafKeys(append(ptt.collectKeys(), tt.collectKeys()...))
+}
+
+func executeTemplate(t *template.Template, missingKey string, data interface{}) (string, error) {
+	t.Option(fmt.Sprintf("missingkey=%s", missingKey))
+	buf := new(bytes.Buffer)
+	err := t.Execute(buf, data)
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// ensureError converts the error of executing a template with missingkey=error
+func ensureError(err error, refs []*KeyRef) error {
+	var errReq *errRequired
+	if errors.As(err, &errReq) {
+		for _, ref := range refs {
+			if ref.Required && ref.Message == errReq.message {
+				return fmt.Errorf("missing required key '%s': %s", ref.Key, errReq.message)
+			}
+		}
+		return fmt.Errorf("missing required key: %s", errReq.message)
+	}
+	if !strings.Contains(err.Error(), "map has no entry for key") {
+		return fmt.Errorf("failed to execute template: %v", err)
+	}
+	return fmt.Errorf("missing key found: %v", err)
+}
+
+// Ensure no missing keys in the template file and its output path
 func (tmpl *Tmpl) Ensure(file string) error {
-	data := tmpl.Data
-	t, err := template.ParseFiles(file)
+	t, tt, err := tmpl.parseTemplate(file)
 	if err != nil {
 		return fmt.Errorf("error parsing template(s): %v", err)
 	}
+	pt, ptt, err := tmpl.parsePath(file)
+	if err != nil {
+		return err
+	}
+	refs := fileKeys(tt, ptt)
+	data := fillGuardedKeys(tmpl.Data, refs)
 
 	// check missing keys
-	t.Option(missingKeyError)
-	buf := new(bytes.Buffer)
-	err = t.Execute(buf, data)
+	_, err = executeTemplate(pt, missingKeyError, data)
 	if err != nil {
-		if !strings.Contains(err.Error(), "map has no entry for key") {
-			return fmt.Errorf("failed to execute template: %v", err)
-		}
-		return fmt.Errorf("missing key found: %v", err)
+		return ensureError(err, refs)
+	}
+	_, err = executeTemplate(t, missingKeyError, data)
+	if err != nil {
+		return ensureError(err, refs)
 	}
 	return nil
 }
 
-// Keys store all missing keys to dataFlattenMap
+// Keys store all missing keys of the template file and its output path to dataFlattenMap.
+// The keys given to 'default' have the default value
 func (tmpl *Tmpl) Keys(file string, dataFlattenMap map[string]interface{}) error {
-	re := tmpl.Re
-	// file to LineMeta
-	f, err := os.Open(file)
+	_, tt, err := tmpl.parseTemplate(file)
 	if err != nil {
-		return fmt.Errorf("failed to open file: %v", err)
+		return fmt.Errorf("error parsing template(s): %v", err)
 	}
-	defer f.Close()
-	var lines []string
-	reader := bufio.NewReader(f)
-	for {
-		line, err := reader.ReadString('\n')
-		if err != nil {
-			break
-		}
-		line = strings.TrimSuffix(line, "\n")
-		lines = append(lines, line)
+	_, ptt, err := tmpl.parsePath(file)
+	if err != nil {
+		return err
 	}
-	for _, line := range lines {
-		subMatched := re.FindAllStringSubmatch(line, -1)
-		for _, x := range subMatched {
-			_, ok := dataFlattenMap[x[1]]
-			if !ok {
-				dataFlattenMap[x[1]] = ""
+	for _, ref := range fileKeys(tt, ptt) {
+		_, ok := dataFlattenMap[ref.Key]
+		if !ok {
+			dataFlattenMap[ref.Key] = ""
+			if ref.HasDefault && ref.Default != nil {
+				dataFlattenMap[ref.Key] = ref.Default
 			}
 		}
 	}
@@ -324,158 +628,356 @@ func (tmpl *Tmpl) Keys(file string, dataFlattenMap map[string]interface{}) error
 
 // Execute gotemplate
 func (tmpl *Tmpl) Execute(file string, dataFlattenMap map[string]interface{}) error {
-	re := tmpl.Re
 	data := tmpl.Data
 	opts := tmpl.TmplOpts
 	interactive := opts.Interactive
 	//outDir := opts.OutDir
-	t, err := template.ParseFiles(file)
+	t, tt, err := tmpl.parseTemplate(file)
 	if err != nil {
 		return fmt.Errorf("error parsing template(s): %v", err)
 	}
+	pt, ptt, err := tmpl.parsePath(file)
+	if err != nil {
+		return err
+	}
 
-	fileinfo, err := os.Stat(file)
+	mode, err := tmpl.tmplFileMode(file)
+	if err != nil {
+		return err
+	}
+	_, inDir := tmpl.relPaths[file]
 	tfm := &TmplFileMeta{
 		Name:     path.Base(file),
 		OrigPath: file,
-		Mode:     fileinfo.Mode(),
+		InDir:    inDir,
+		Mode:     mode,
 		//Changed: ooo,
 	}
-	t.Option(fmt.Sprintf("missingkey=%s", opts.MissingKey))
-	buf := new(bytes.Buffer)
-	err = t.Execute(buf, data)
+	tfm.Mode = tmpl.outMode(tfm.Mode, tt.frontMatter)
+	refs := fileKeys(tt, ptt)
+	if interactive {
+		err = tmpl.inputMissingKeys(file, tt, refs, dataFlattenMap)
+		if err != nil {
+			return err
+		}
+		data = expand(dataFlattenMap)
+	}
+	data = fillGuardedKeys(data, refs)
+	tfm.RelPath, err = executeTemplate(pt, opts.MissingKey, data)
+	if err == nil {
+		tfm.Content, err = executeTemplate(t, opts.MissingKey, data)
+	}
 	if err != nil {
-		if !strings.Contains(err.Error(), "map has no entry for key") {
+		if !strings.Contains(err.Error(), "map has no entry for key") || interactive {
 			return fmt.Errorf("failed to execute template: %v", err)
 		}
-		if !interactive {
-			return fmt.Errorf("interactive flag is disabled, but the missing key is found: %v", err)
+		return fmt.Errorf("interactive flag is disabled, but the missing key is found: %v", err)
+	}
+	tmpl.Files = append(tmpl.Files, tfm)
+	return nil
+}
+
+// inputMissingKeys asks the prompter for the missing keys of the parse tree in order of appearance
+// and stores the values to dataFlattenMap. The keys set only by the defaults of the schema
+// are asked with the defaults
+func (tmpl *Tmpl) inputMissingKeys(file string, tt *tmplTrees, refs []*KeyRef, dataFlattenMap map[string]interface{}) error {
+	p := tmpl.prompter()
+	questions := tmpl.questions(file, tt, refs, dataFlattenMap)
+	for i := 0; i < len(questions); {
+		q := questions[i]
+		values, err := p.Ask(q)
+		if err == ErrBack {
+			if i > 0 {
+				i--
+			}
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read the value of '%s': %v", q.Keys[0].Key, err)
 		}
-	} else {
-		tfm.Content = buf.String()
-		tmpl.Files = append(tmpl.Files, tfm)
-		//continue
-		return nil
+		for j, f := range q.Fields {
+			if j < len(values) {
+				if err := tmpl.storeInput(f, values[j], dataFlattenMap); err != nil {
+					return err
+				}
+			}
+		}
+		i++
 	}
+	return nil
+}
 
-	// file to LineMeta
-	f, err := os.Open(file)
-	if err != nil {
-		return fmt.Errorf("failed to open file: %v", err)
+// questions groups the keys to ask on each line into questions
+func (tmpl *Tmpl) questions(file string, tt *tmplTrees, refs []*KeyRef, dataFlattenMap map[string]interface{}) []*Question {
+	questions := []*Question{}
+	asked := make(map[string]bool)
+	for i := 0; i < len(refs); {
+		// keys on the same line share the context
+		ref := refs[i]
+		q := &Question{File: file, Title: "missing key found"}
+		for ; i < len(refs) && refs[i].File == ref.File && refs[i].Line == ref.Line; i++ {
+			key := refs[i].Key
+			if !asked[key] && tmpl.askable(key, dataFlattenMap) {
+				asked[key] = true
+				q.Keys = append(q.Keys, refs[i])
+				q.Fields = append(q.Fields, tmpl.field(refs[i], dataFlattenMap))
+			}
+		}
+		if len(q.Keys) == 0 {
+			continue
+		}
+		if ref.File != tt.name {
+			q.Title = fmt.Sprintf("missing key found in '%s'", ref.File)
+		}
+		if !tmpl.TmplOpts.FoldContext {
+			q.Context = contextLines(tt.texts[ref.File], ref.Line)
+		}
+		questions = append(questions, q)
+	}
+	return questions
+}
+
+// askable reports whether the key is missing, or set only by the defaults of the schema
+// and not input yet
+func (tmpl *Tmpl) askable(key string, dataFlattenMap map[string]interface{}) bool {
+	if !hasKey(tmpl.Data, dataFlattenMap, key) {
+		return true
 	}
-	defer f.Close()
-	lineMetaList := []*LineMeta{}
-	reader := bufio.NewReader(f)
-	for {
-		line, err := reader.ReadString('\n')
+	return tmpl.KeySource(key) == schemaFormat && tmpl.inputs[key] == nil
+}
+
+var secretKeyRe = regexp.MustCompile(`(?i)(password|passwd|secret|token|api_?key|private_?key|credential)`)
+
+// field tells how to ask for the key of the ref. The default is the value of the data,
+// of the default pipe or of the schema, and the input is checked against the schema
+func (tmpl *Tmpl) field(ref *KeyRef, dataFlattenMap map[string]interface{}) *Field {
+	key := ref.Key
+	sub := tmpl.Schema.lookup(key)
+	f := &Field{Key: key, Type: tmpl.expectedType(key)}
+	if value, ok := dataFlattenMap[key]; ok {
+		f.Default, f.HasDefault = scalarString(value), true
+	} else if ref.HasDefault && ref.Default != nil {
+		f.Default, f.HasDefault = scalarString(ref.Default), true
+	} else if sub != nil && sub.Default != nil {
+		f.Default, f.HasDefault = scalarString(sub.Default), true
+	}
+	elems := splitKey(key)
+	f.Secret = secretKeyRe.MatchString(elems[len(elems)-1])
+	if sub != nil {
+		for _, v := range sub.Enum {
+			f.Enum = append(f.Enum, scalarString(v))
+		}
+		f.Description = sub.Description
+		if f.Description == "" {
+			f.Description = sub.Title
+		}
+		f.Secret = f.Secret || sub.Format == "password" || sub.WriteOnly
+	}
+	f.Validate = func(input string) error {
+		if input == "" && ref.Required {
+			if ref.Message != "" {
+				return errors.New(ref.Message)
+			}
+			return errors.New("a value is required")
+		}
+		value, err := tmpl.coerceValue(key, input)
 		if err != nil {
-			break
+			return err
 		}
-		line = strings.TrimSuffix(line, "\n")
-		space := countLeadingSpace(line)
-		lineMeta := LineMeta{Line: line, Space: space}
-		lineMetaList = append(lineMetaList, &lineMeta)
+		if sub != nil {
+			if errs := sub.Validate(value); errs != nil {
+				return errors.New(errs[0].Message)
+			}
+		}
+		return nil
 	}
+	return f
+}
 
-	// execute template with different missingkey option
-	t.Option(missingKeyDefault)
-	renderedOutputBuf := new(bytes.Buffer)
-	err = t.Execute(renderedOutputBuf, data)
+// storeInput converts the input of the field and stores it to dataFlattenMap.
+// The input becomes the default if the field is asked again
+func (tmpl *Tmpl) storeInput(f *Field, input string, dataFlattenMap map[string]interface{}) error {
+	value, err := tmpl.coerceValue(f.Key, input)
 	if err != nil {
-		return fmt.Errorf("failed to execute template with default option '%s': %v", missingKeyDefault, err)
+		return fmt.Errorf("wrong value for '%s': %v", f.Key, err)
+	}
+	dataFlattenMap[f.Key] = value
+	if tmpl.inputs == nil {
+		tmpl.inputs = make(map[string]*Field)
 	}
-	reader = bufio.NewReader(strings.NewReader(renderedOutputBuf.String()))
-	i := 0
-	for {
-		line, err := reader.ReadString('\n')
-		// TODO EOF
+	tmpl.inputs[f.Key] = f
+	f.Default, f.HasDefault = input, true
+	return nil
+}
+
+// allQuestions returns the questions for the missing keys of all the template files
+func (tmpl *Tmpl) allQuestions(dataFlattenMap map[string]interface{}) ([]*Question, error) {
+	questions := []*Question{}
+	for _, file := range tmpl.TmplOpts.TmplFiles {
+		_, tt, err := tmpl.parseTemplate(file)
 		if err != nil {
-			break
+			return nil, fmt.Errorf("error parsing template(s): %v", err)
 		}
-		line = strings.TrimSuffix(line, "\n")
-		if i >= len(lineMetaList) {
-			fmt.Println("failed to interaction: i > len(lineMetaList)", i, len(lineMetaList))
-		}
-		if strings.Contains(line, "<no value>") {
-			lineMetaList[i].ReplacedLine = line
-			lineMetaList[i].NoValue = true
+		_, ptt, err := tmpl.parsePath(file)
+		if err != nil {
+			return nil, err
 		}
-		i = i + 1
+		questions = append(questions, tmpl.questions(file, tt, fileKeys(tt, ptt), dataFlattenMap)...)
 	}
+	return questions, nil
+}
 
-	c := InitializedNavColorMeta()
-	c.NavFile.Printf("[%s]\n", file)
-	for i, lineMeta := range lineMetaList {
-		if lineMeta.NoValue {
-			prevSpace := lineMetaList[i].Space
-			tmpLineMetaList := []LineMeta{}
-			for j := i - 1; j >= 0; j-- {
-				space := lineMetaList[j].Space
-				if lineMetaList[j].Line != "" && lineMetaList[j].Line != "\n" && space < prevSpace {
-					tmpLineMeta := LineMeta{Line: lineMetaList[j].Line}
-					tmpLineMetaList = append(tmpLineMetaList, tmpLineMeta)
-					prevSpace = space
-					if space == 0 {
-						break
-					}
-				}
-			}
-			ttListLen := len(tmpLineMetaList)
-
-			line := lineMetaList[i].Line
-			subMatched := re.FindAllStringSubmatch(line, -1)
-
-			// do not show context if a key already has value
-			needToInput := false
-			for _, x := range subMatched {
-				_, ok := dataFlattenMap[x[1]]
-				if !ok {
-					needToInput = true
-					break
-				} else {
-				}
+// fillForm asks for the missing keys of all the template files at once
+// if the prompter can fill forms. Secret keys are left out of the form
+// and asked one by one afterwards, so their values are never written to a file
+func (tmpl *Tmpl) fillForm(dataFlattenMap map[string]interface{}) error {
+	fp, ok := tmpl.prompter().(FormPrompter)
+	if !ok {
+		return nil
+	}
+	questions, err := tmpl.allQuestions(dataFlattenMap)
+	if err != nil {
+		return err
+	}
+	fields := []*Field{}
+	secrets := []*Question{}
+	seen := make(map[string]bool)
+	for _, q := range questions {
+		secret := &Question{File: q.File, Title: q.Title}
+		for i, f := range q.Fields {
+			if seen[f.Key] {
+				continue
 			}
-			if !needToInput {
+			seen[f.Key] = true
+			if f.Secret {
+				secret.Keys = append(secret.Keys, q.Keys[i])
+				secret.Fields = append(secret.Fields, f)
 				continue
 			}
-
-			if !opts.FoldContext {
-				//fmt.Printf("\n")
-				c.NavTitle.Printf("missing key found\n")
-				for k := ttListLen - 1; k >= 0; k-- {
-					tmpLineMeta := tmpLineMetaList[k]
-					c.NavContext.Printf("%s\n", tmpLineMeta.Line)
+			fields = append(fields, f)
+		}
+		if len(secret.Fields) > 0 {
+			secrets = append(secrets, secret)
+		}
+	}
+	if len(fields) > 0 {
+		values, err := fp.Fill(fields)
+		if err != nil {
+			return fmt.Errorf("failed to fill the form: %v", err)
+		}
+		for i, f := range fields {
+			if i < len(values) {
+				if err := tmpl.storeInput(f, values[i], dataFlattenMap); err != nil {
+					return err
 				}
-				c.NavContext.Printf("%s\n", lineMetaList[i].Line)
 			}
-			for _, x := range subMatched {
-				_, ok := dataFlattenMap[x[1]]
-				if !ok {
-					c.NavInput.Printf("value for '%s': ", x[1])
-					val := getValueStdin()
-					dataFlattenMap[x[1]] = val
-				}
+		}
+	}
+	for i := 0; i < len(secrets); {
+		q := secrets[i]
+		values, err := fp.Ask(q)
+		if err == ErrBack {
+			if i > 0 {
+				i--
 			}
-			if !opts.FoldContext {
-				fmt.Printf("\n")
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		for j, f := range q.Fields {
+			if j < len(values) {
+				if err := tmpl.storeInput(f, values[j], dataFlattenMap); err != nil {
+					return err
+				}
 			}
 		}
+		i++
 	}
-	newNestedDataMap := expand(dataFlattenMap)
-	t.Option(fmt.Sprintf("missingkey=%s", opts.MissingKey))
+	return nil
+}
 
-	// execute template with new data
-	buf = new(bytes.Buffer)
-	err = t.Execute(buf, newNestedDataMap)
+// parseReader parses the template read from src
+func (tmpl *Tmpl) parseReader(name string, src io.Reader) (*template.Template, *tmplTrees, error) {
+	dat, err := ioutil.ReadAll(src)
+	if err != nil {
+		return nil, nil, err
+	}
+	t, tt, err := tmpl.parseText(name, string(dat))
+	if err != nil {
+		return nil, nil, fmt.Errorf("error parsing template(s): %v", err)
+	}
+	return t, tt, nil
+}
+
+// Render executes the template read from src with the data and writes the result to w.
+// The name is used by error messages. Nothing is written if the template fails,
+// and missing keys are asked to the prompter in interactive mode
+func (tmpl *Tmpl) Render(name string, src io.Reader, w io.Writer) error {
+	t, tt, err := tmpl.parseReader(name, src)
+	if err != nil {
+		return err
+	}
+	data := tmpl.Data
+	refs := leafKeys(tt.collectKeys())
+	if tmpl.TmplOpts.Interactive {
+		dataFlattenMap := make(map[string]interface{})
+		nestedToFlattenMap(data, dataFlattenMap, "", false)
+		err = tmpl.inputMissingKeys(name, tt, refs, dataFlattenMap)
+		if err != nil {
+			return err
+		}
+		data = expand(dataFlattenMap)
+	}
+	content, err := executeTemplate(t, tmpl.TmplOpts.MissingKey, fillGuardedKeys(data, refs))
 	if err != nil {
-		//TODO
 		return fmt.Errorf("failed to execute template: %v", err)
 	}
-	tfm.Content = buf.String()
-	tmpl.Files = append(tmpl.Files, tfm)
+	_, err = io.WriteString(w, content)
+	return err
+}
+
+// EnsureReader checks that the template read from src has no missing keys
+func (tmpl *Tmpl) EnsureReader(name string, src io.Reader) error {
+	t, tt, err := tmpl.parseReader(name, src)
+	if err != nil {
+		return err
+	}
+	refs := leafKeys(tt.collectKeys())
+	_, err = executeTemplate(t, missingKeyError, fillGuardedKeys(tmpl.Data, refs))
+	if err != nil {
+		return ensureError(err, refs)
+	}
 	return nil
 }
 
+// KeysReader returns the keys referenced by the template read from src in order of appearance
+func (tmpl *Tmpl) KeysReader(name string, src io.Reader) ([]*KeyRef, error) {
+	_, tt, err := tmpl.parseReader(name, src)
+	if err != nil {
+		return nil, err
+	}
+	return leafKeys(tt.collectKeys()), nil
+}
+
+// contextLines returns the line and its parent lines that have less indentation
+func contextLines(text string, line int) []*LineMeta {
+	lines := strings.Split(text, "\n")
+	if line < 1 || line > len(lines) {
+		return nil
+	}
+	lineMetaList := []*LineMeta{{Line: lines[line-1], Space: countLeadingSpace(lines[line-1])}}
+	prevSpace := lineMetaList[0].Space
+	for j := line - 2; j >= 0 && prevSpace > 0; j-- {
+		space := countLeadingSpace(lines[j])
+		if strings.TrimSpace(lines[j]) != "" && space < prevSpace {
+			lineMetaList = append([]*LineMeta{{Line: lines[j], Space: space}}, lineMetaList...)
+			prevSpace = space
+		}
+	}
+	return lineMetaList
+}
+
 // ExtractKeys get all missing keys and processed key:value pairs with given format (by default, yaml)
 func (tmpl *Tmpl) ExtractKeys() (string, error) {
 	tmpMissingKeyOption := tmpl.TmplOpts.MissingKey
@@ -490,82 +992,269 @@ func (tmpl Tmpl) extractKeys() (string, error) {
 	dataFlattenMap := make(map[string]interface{})
 	givenDataFlattenMap := make(map[string]interface{})
 	data := tmpl.Data
-	//fmt.Println("DEBUG: tmpl.Data:", data)
 	nestedToFlattenMap(data, givenDataFlattenMap, "", false)
-	for _, file := range tmplFiles {
-		err := tmpl.Execute(file, givenDataFlattenMap)
-		if err != nil {
-			return "", err
+	if tmpl.TmplOpts.Interactive {
+		for _, file := range tmplFiles {
+			err := tmpl.Execute(file, givenDataFlattenMap)
+			if err != nil {
+				return "", err
+			}
 		}
+		data = expand(givenDataFlattenMap)
 	}
-	for _, file := range tmplFiles {
+	for _, file := range append(tmplFiles, tmpl.CopyFiles...) {
 		err := tmpl.Keys(file, dataFlattenMap)
 		if err != nil {
 			return "", err
 		}
 	}
-	// fill values with the given data
-	for key := range dataFlattenMap {
-		value, ok := givenDataFlattenMap[key]
-		if ok {
-			dataFlattenMap[key] = value
+	// fill values with the given data, and the defaults for the missing keys
+	keysMap := make(map[string]interface{})
+	for key, def := range dataFlattenMap {
+		given := make(map[string]interface{})
+		missing := []string{}
+		resolveKey(data, splitKey(key), "", given, &missing)
+		for _, k := range missing {
+			keysMap[k] = def
 		}
-	}
-
-	if tmpl.TmplOpts.ShowOnlyMissingKey {
-		for key := range givenDataFlattenMap {
-			_, ok := dataFlattenMap[key]
-			if ok {
-				delete(dataFlattenMap, key)
+		if !tmpl.TmplOpts.ShowOnlyMissingKey {
+			for k, v := range given {
+				keysMap[k] = v
 			}
 		}
 	}
-	dataOut, err := tmpl.marshalData(dataFlattenMap)
+	dataOut, err := tmpl.marshalData(keysMap)
 	return dataOut, err
 }
 
-func (tmpl Tmpl) marshalData(dataFlattenMap map[string]interface{}) (string, error) {
-	expandedKeys := expand(dataFlattenMap)
-	dataOut := ""
-	if len(dataFlattenMap) > 0 {
-		if tmpl.TmplOpts.DataOutFormat == "" {
-			ext := getFileExt(tmpl.TmplOpts.DataOutFile)
-			switch ext {
-			case "json", "yml", "yaml", "ini", "kv":
-				tmpl.TmplOpts.DataOutFormat = ext
-			}
+// resolveKey sets the values of the data for the path segments of a template key to given,
+// and appends the flattened keys without values to missing. The list index '[0]' of the key
+// stands for every element of the list. The whole object or list at the end of the key is given,
+// and so is an object indexed like a list by a range over a map
+func resolveKey(value interface{}, elems []string, path string, given map[string]interface{}, missing *[]string) {
+	if len(elems) == 0 {
+		nestedToFlattenMap(value, given, path, false)
+		return
+	}
+	elem := elems[0]
+	_, isIndex := keyIndex(elem)
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if isIndex {
+			nestedToFlattenMap(v, given, path, false)
+			return
 		}
-
-		switch tmpl.TmplOpts.DataOutFormat {
-		case "kv":
-			for key, value := range dataFlattenMap {
-				dataOut = fmt.Sprintf("%s%s=%v\n", dataOut, trimKeyPrefix(key), value)
-			}
-		case "json":
-			dd, err := json.MarshalIndent(&expandedKeys, "", "  ")
-			if err != nil {
-				return "", fmt.Errorf("failed to marshal keys map to json: %v", err)
+		if val, ok := v[elem]; ok {
+			resolveKey(val, elems[1:], path+"."+elem, given, missing)
+			return
+		}
+	case []interface{}:
+		if isIndex {
+			if len(v) == 0 {
+				given[path] = v
+				return
 			}
-			dataOut = fmt.Sprintf("%s\n", string(dd))
-		default:
-			dd, err := yaml.Marshal(&expandedKeys)
-			if err != nil {
-				return "", fmt.Errorf("failed to marshal keys map to yaml: %v", err)
+			for i, val := range v {
+				resolveKey(val, elems[1:], fmt.Sprintf("%s[%d]", path, i), given, missing)
 			}
-			dataOut = fmt.Sprintf("---\n\n%s", string(dd))
-			//dataOut = fmt.Sprintf("%s", string(dd))
+			return
+		}
+	}
+	*missing = append(*missing, path+joinElems(elems))
+}
+
+// joinElems joins the path segments of a key like '.b[0].c'
+func joinElems(elems []string) string {
+	key := ""
+	for _, elem := range elems {
+		if _, ok := keyIndex(elem); ok {
+			key += elem
+		} else {
+			key += "." + elem
 		}
 	}
+	return key
+}
+
+func (tmpl Tmpl) marshalData(dataFlattenMap map[string]interface{}) (string, error) {
+	return tmpl.marshalObject(expand(dataFlattenMap))
+}
+
+// marshalObject writes the data object with the output format,
+// or the format of the extension of the output file
+func (tmpl Tmpl) marshalObject(data map[string]interface{}) (string, error) {
+	if len(data) == 0 {
+		return "", nil
+	}
+	if tmpl.TmplOpts.DataOutFormat == schemaFormat {
+		return marshalSchema(data)
+	}
+	format := LookupFormat(tmpl.TmplOpts.DataOutFormat)
+	if tmpl.TmplOpts.DataOutFormat == "" {
+		format = LookupFormat(getFileExt(tmpl.TmplOpts.DataOutFile))
+	}
+	if format == nil {
+		format = lookupFormatOrYaml("")
+	}
+	dataOut, err := format.Marshal(data)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal keys map to %s: %v", format.Name, err)
+	}
 	return dataOut, nil
 }
 
 // WriteDataObject writes the filled data to the output
 func (tmpl *Tmpl) WriteDataObject(dataOut string) {
 	if tmpl.TmplOpts.DataOutFile != "" {
-		WriteStringToFileAndCreateDir(tmpl.TmplOpts.DataOutFile, dataOut, tmpl.TmplOpts.Overwrite)
+		writeStringToFile(tmpl.TmplOpts.DataOutFile, dataOut, 0, tmpl.TmplOpts.Overwrite, tmpl.prompter())
 	} else {
-		fmt.Printf("%s", dataOut)
+		io.WriteString(tmpl.out(), dataOut)
+	}
+}
+
+func (tmpl *Tmpl) out() io.Writer {
+	if tmpl.Out == nil {
+		return os.Stdout
+	}
+	return tmpl.Out
+}
+
+func (tmpl *Tmpl) colors() *NavColorMeta {
+	if tmpl.Colors == nil {
+		return InitializedNavColorMeta()
+	}
+	return tmpl.Colors
+}
+
+func (tmpl *Tmpl) prompter() Prompter {
+	if tmpl.TmplOpts.NoTTY {
+		return noTTYPrompter{}
+	}
+	if tmpl.Prompter == nil {
+		return StdinPrompter()
+	}
+	return tmpl.Prompter
+}
+
+// DataObject returns the merged data object with the output format
+func (tmpl *Tmpl) DataObject() (string, error) {
+	return tmpl.marshalObject(tmpl.Data)
+}
+
+// KeySource returns the data file or 'env' the value of the key came from
+func (tmpl *Tmpl) KeySource(key string) string {
+	if tmpl.merger == nil {
+		return ""
+	}
+	return tmpl.merger.sourceOf(appendKeyPrefix(key))
+}
+
+// Deps returns the environment variables, files and commands the template files depend on
+func (tmpl *Tmpl) Deps() ([]*Dep, error) {
+	deps := []*Dep{}
+	for _, file := range append(tmpl.TmplOpts.TmplFiles, tmpl.CopyFiles...) {
+		_, tt, err := tmpl.parseTemplate(file)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing template(s): %v", err)
+		}
+		_, ptt, err := tmpl.parsePath(file)
+		if err != nil {
+			return nil, err
+		}
+		deps = append(deps, ptt.collectDeps()...)
+		deps = append(deps, tt.collectDeps()...)
+	}
+	return deps, nil
+}
+
+// DepsReport returns a table of the dependencies of the template files with where they are used.
+// Names not given as literals are shown as '?'
+func (tmpl *Tmpl) DepsReport() (string, error) {
+	deps, err := tmpl.Deps()
+	if err != nil {
+		return "", err
+	}
+	buf := new(bytes.Buffer)
+	w := tabwriter.NewWriter(buf, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "FUNC\tNAME\tFILE\n")
+	for _, dep := range deps {
+		name := dep.Name
+		if name == "" {
+			name = unknownDot
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s:%d\n", dep.Func, name, dep.File, dep.Line)
+	}
+	w.Flush()
+	return buf.String(), nil
+}
+
+// SourceReport returns a table of the keys of the merged data object
+// with their values and the sources they came from
+func (tmpl *Tmpl) SourceReport() string {
+	keys, dataFlattenMap := flattenData(tmpl.Data)
+	buf := new(bytes.Buffer)
+	w := tabwriter.NewWriter(buf, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "KEY\tVALUE\tSOURCE\n")
+	for _, key := range keys {
+		value := scalarString(dataFlattenMap[key])
+		if strings.ContainsAny(value, "\t\n") {
+			value = strconv.Quote(value)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", trimKeyPrefix(key), value, tmpl.KeySource(key))
 	}
+	w.Flush()
+	return buf.String()
+}
+
+// outMode returns the mode of the output file.
+// The mode of the front matter is used first, then the mode option and the mode of the source file
+func (tmpl *Tmpl) outMode(srcMode os.FileMode, fm *FrontMatter) os.FileMode {
+	if fm != nil && fm.Mode != 0 {
+		return fm.Mode
+	}
+	if tmpl.TmplOpts.Mode != 0 {
+		return tmpl.TmplOpts.Mode
+	}
+	return srcMode.Perm()
+}
+
+func (tmpl *Tmpl) isCopyFile(file string) bool {
+	for _, f := range tmpl.CopyFiles {
+		if f == file {
+			return true
+		}
+	}
+	return false
+}
+
+// Copy adds the file that is not a template to be stored as it is
+func (tmpl *Tmpl) Copy(file string) error {
+	pt, _, err := tmpl.parsePath(file)
+	if err != nil {
+		return err
+	}
+	relPath, err := executeTemplate(pt, tmpl.TmplOpts.MissingKey, tmpl.Data)
+	if err != nil {
+		return fmt.Errorf("failed to execute path template: %v", err)
+	}
+	fileinfo, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+	dat, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	_, inDir := tmpl.relPaths[file]
+	tmpl.Files = append(tmpl.Files, &TmplFileMeta{
+		Name:     path.Base(file),
+		OrigPath: file,
+		RelPath:  relPath,
+		InDir:    inDir,
+		Mode:     tmpl.outMode(fileinfo.Mode(), nil),
+		Content:  string(dat),
+	})
+	return nil
 }
 
 // ExecuteFiles executes template files with datafile
@@ -575,6 +1264,27 @@ func (tmpl *Tmpl) ExecuteFiles() error {
 	dataFlattenMap := make(map[string]interface{})
 	nestedToFlattenMap(data, dataFlattenMap, "", false)
 
+	// the values input in interactive mode are validated after executing the templates
+	interactive := tmpl.TmplOpts.Interactive
+	if !interactive {
+		err := tmpl.Validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	if interactive && tmpl.TmplOpts.NoTTY {
+		err := tmpl.checkAnswered(dataFlattenMap)
+		if err != nil {
+			return err
+		}
+	} else if interactive && tmpl.TmplOpts.Form {
+		err := tmpl.fillForm(dataFlattenMap)
+		if err != nil {
+			return err
+		}
+	}
+
 	tmplFiles := tmpl.TmplOpts.TmplFiles
 	for _, file := range tmplFiles {
 		err := tmpl.Execute(file, dataFlattenMap)
@@ -582,12 +1292,45 @@ func (tmpl *Tmpl) ExecuteFiles() error {
 			return err
 		}
 	}
-	if tmpl.TmplOpts.DataOutFile != "" {
+	for _, file := range tmpl.CopyFiles {
+		err := tmpl.Copy(file)
+		if err != nil {
+			return err
+		}
+	}
+	if interactive {
+		tmpl.Data = expand(dataFlattenMap)
+		err := tmpl.Validate()
+		if err != nil {
+			return err
+		}
+		if tmpl.TmplOpts.Answers != "" && !tmpl.TmplOpts.NoTTY && !tmpl.TmplOpts.DryRun {
+			err = tmpl.saveAnswers(dataFlattenMap)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if tmpl.TmplOpts.DataOutFile != "" && !tmpl.TmplOpts.DryRun {
 		dataOut, err := tmpl.marshalData(dataFlattenMap)
 		if err != nil {
 			return err
 		}
-		WriteStringToFileAndCreateDir(tmpl.TmplOpts.DataOutFile, dataOut, tmpl.TmplOpts.Overwrite)
+		err = writeStringToFile(tmpl.TmplOpts.DataOutFile, dataOut, 0, tmpl.TmplOpts.Overwrite, tmpl.prompter())
+		if err != nil {
+			return fmt.Errorf("failed to export data: %v", err)
+		}
+	}
+	return nil
+}
+
+// Validate checks the data against the schema if any
+func (tmpl *Tmpl) Validate() error {
+	if tmpl.Schema == nil {
+		return nil
+	}
+	if errs := tmpl.Schema.Validate(tmpl.Data); errs != nil {
+		return errs
 	}
 	return nil
 }
@@ -595,7 +1338,7 @@ func (tmpl *Tmpl) ExecuteFiles() error {
 // EnsureFiles check for missing keys in the template files
 func (tmpl *Tmpl) EnsureFiles() error {
 	tmplFiles := tmpl.TmplOpts.TmplFiles
-	for _, file := range tmplFiles {
+	for _, file := range append(tmplFiles, tmpl.CopyFiles...) {
 		err := tmpl.Ensure(file)
 		if err != nil {
 			return err
@@ -604,13 +1347,14 @@ func (tmpl *Tmpl) EnsureFiles() error {
 	return nil
 }
 
-// FillDestPath fill in the values for destination path
-func (tmpl *Tmpl) FillDestPath(trimPrefixForDestPath string) {
+// FillDestPath fill in the values for destination path.
+// The paths under the outdir must not be absolute or lead out of it
+func (tmpl *Tmpl) FillDestPath(trimPrefixForDestPath string) error {
 	output := tmpl.TmplOpts.Output
 	outdir := tmpl.TmplOpts.OutDir
 	//ignoreDirOfOrigPath := tmpl.TmplOpts.IgnoreDirOfOrigPath
 	if outdir == "" && output == "" {
-		return
+		return nil
 	}
 	isMultipleTemplates := false
 	if len(tmpl.Files) > 1 {
@@ -618,26 +1362,110 @@ func (tmpl *Tmpl) FillDestPath(trimPrefixForDestPath string) {
 	}
 	for _, tmplMeta := range tmpl.Files {
 		if outdir != "" {
-			origPath := tmplMeta.OrigPath
-			if trimPrefixForDestPath != "" {
+			// the rendered path is relative to the template directory
+			// to mirror its tree if the file is found in it
+			origPath := tmplMeta.RelPath
+			if !tmplMeta.InDir && trimPrefixForDestPath != "" {
 				origPath = strings.TrimPrefix(origPath, trimPrefixForDestPath)
 			}
 			//if ignoreDirOfOrigPath {
 			//	origPath = tmplMeta.Name
 			//}
-			if strings.HasSuffix(origPath, ".tpl") {
-				origPath = strings.TrimSuffix(origPath, ".tpl")
-			} else if strings.HasSuffix(origPath, ".tmpl") {
-				origPath = strings.TrimSuffix(origPath, ".tmpl")
-			}
+			origPath = trimTmplExt(origPath)
 			if output != "" && !isMultipleTemplates {
 				origPath = output
+			} else {
+				relPath, err := cleanRelPath(origPath)
+				if err != nil {
+					return fmt.Errorf("wrong output path '%s' of '%s': %v", origPath, tmplMeta.OrigPath, err)
+				}
+				origPath = relPath
 			}
 			tmplMeta.DestPath = outdir + string(os.PathSeparator) + origPath
 		} else {
 			tmplMeta.DestPath = output
 		}
 	}
+	return nil
+}
+
+// cleanRelPath cleans the path rendered for the outdir.
+// Absolute paths, empty segments and paths leading out of the outdir are rejected
+func cleanRelPath(p string) (string, error) {
+	if p == "" {
+		return "", errors.New("empty path")
+	}
+	if filepath.IsAbs(p) || strings.HasPrefix(filepath.ToSlash(p), "/") {
+		return "", errors.New("absolute path")
+	}
+	for _, elem := range strings.Split(filepath.ToSlash(p), "/") {
+		if elem == "" {
+			return "", errors.New("empty path segment")
+		}
+	}
+	p = filepath.Clean(p)
+	if p == "." || p == ".." || strings.HasPrefix(p, ".."+string(filepath.Separator)) {
+		return "", errors.New("path leads out of the outdir")
+	}
+	return p, nil
+}
+
+// CheckDestFiles compares the processed templates with the files at the destination paths
+func (tmpl *Tmpl) CheckDestFiles() error {
+	for _, tmplMeta := range tmpl.Files {
+		if tmplMeta.DestPath == "" {
+			continue
+		}
+		fileinfo, err := os.Stat(tmplMeta.DestPath)
+		if os.IsNotExist(err) {
+			tmplMeta.Exists = false
+			tmplMeta.Changed = true
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		dat, err := ioutil.ReadFile(tmplMeta.DestPath)
+		if err != nil {
+			return err
+		}
+		tmplMeta.Exists = true
+		tmplMeta.DestMode = fileinfo.Mode().Perm()
+		tmplMeta.DestContent = string(dat)
+		tmplMeta.Changed = tmplMeta.DestContent != tmplMeta.Content || tmplMeta.DestMode != tmplMeta.Mode.Perm()
+	}
+	return nil
+}
+
+// PrintDiff prints the unified diff of each processed template against its destination file
+// and reports whether any file would be changed
+func (tmpl *Tmpl) PrintDiff() (bool, error) {
+	output := tmpl.TmplOpts.Output
+	outdir := tmpl.TmplOpts.OutDir
+	if outdir == "" && output == "" {
+		return false, fmt.Errorf("dry-run flag requires 'out' or 'outdir' flag")
+	}
+	c := tmpl.colors()
+	out := tmpl.out()
+	changed := false
+	for _, tmplMeta := range tmpl.Files {
+		if tmpl.TmplOpts.ShowProcessedFile {
+			c.ExecInfo.Fprintf(out, "'%s' is processed for '%s' (%s)\n", tmplMeta.OrigPath, tmplMeta.DestPath, tmplMeta.Status())
+		}
+		if !tmplMeta.Changed {
+			continue
+		}
+		changed = true
+		fromFile := tmplMeta.DestPath
+		if !tmplMeta.Exists {
+			fromFile = "/dev/null"
+			fmt.Fprintf(out, "new file mode %04o\n", tmplMeta.Mode.Perm())
+		} else if tmplMeta.DestMode != tmplMeta.Mode.Perm() {
+			fmt.Fprintf(out, "old mode %04o\nnew mode %04o\n", tmplMeta.DestMode, tmplMeta.Mode.Perm())
+		}
+		fmt.Fprintf(out, "%s", UnifiedDiff(fromFile, tmplMeta.DestPath, tmplMeta.DestContent, tmplMeta.Content))
+	}
+	return changed, nil
 }
 
 // WriteProcessedTmpl writes processed template
@@ -648,20 +1476,36 @@ func (tmpl *Tmpl) WriteProcessedTmpl() error {
 	if lenTmplFiles > 1 && output != "" && outdir == "" {
 		return fmt.Errorf("multiple template files given with empty 'outdir' flag and non-empty 'out' flag")
 	}
-	c := InitializedNavColorMeta()
+	if outdir == "" {
+		for _, tmplMeta := range tmpl.Files {
+			if tmplMeta.InDir {
+				return fmt.Errorf("template directory given with empty 'outdir' flag")
+			}
+		}
+	}
+	if tmpl.TmplOpts.Atomic && (outdir != "" || output != "") {
+		return tmpl.writeProcessedTmplAtomic()
+	}
+	c := tmpl.colors()
+	out := tmpl.out()
 	for idx, tmplMeta := range tmpl.Files {
 		if outdir == "" && output == "" {
 			if idx > 0 {
-				fmt.Printf("\n")
+				fmt.Fprintf(out, "\n")
 			}
 			if tmpl.TmplOpts.ShowProcessedFile { // lenTmplFiles > 1 &&
-				c.ExecInfo.Printf("'%s' is processed\n", tmplMeta.OrigPath)
+				c.ExecInfo.Fprintf(out, "'%s' is processed\n", tmplMeta.OrigPath)
+			}
+			fmt.Fprintf(out, "%s", tmplMeta.Content)
+			continue
+		}
+		if tmplMeta.Exists && !tmplMeta.Changed {
+			if tmpl.TmplOpts.ShowProcessedFile {
+				c.ExecInfo.Fprintf(out, "'%s' is processed and stored in '%s' (%s)\n", tmplMeta.OrigPath, tmplMeta.DestPath, tmplMeta.Status())
 			}
-			fmt.Printf("%s", tmplMeta.Content)
 			continue
 		}
-		err := WriteStringToFileAndCreateDir(tmplMeta.DestPath, tmplMeta.Content, tmpl.TmplOpts.Overwrite)
-		//err := WriteStringToFileWithModeAndCreateDir(tmplMeta.DestPath, tmplMeta.Content, tmplMeta.Mode)
+		err := writeStringToFile(tmplMeta.DestPath, tmplMeta.Content, tmplMeta.Mode, tmpl.TmplOpts.Overwrite, tmpl.prompter())
 		if err != nil {
 			switch err.(type) {
 			case *ErrFileExists:
@@ -671,7 +1515,48 @@ func (tmpl *Tmpl) WriteProcessedTmpl() error {
 			}
 		}
 		if tmpl.TmplOpts.ShowProcessedFile {
-			c.ExecInfo.Printf("'%s' is processed and stored in '%s'\n", tmplMeta.OrigPath, tmplMeta.DestPath)
+			c.ExecInfo.Fprintf(out, "'%s' is processed and stored in '%s' (%s)\n", tmplMeta.OrigPath, tmplMeta.DestPath, tmplMeta.Status())
+		}
+	}
+	return nil
+}
+
+// writeProcessedTmplAtomic stages all processed templates and commits them together,
+// so the output is left as it was if any of them fails to be stored.
+// A file whose overwrite is declined is skipped and the others are still stored
+func (tmpl *Tmpl) writeProcessedTmplAtomic() error {
+	tx := &FileTx{}
+	stored := []*TmplFileMeta{}
+	for _, tmplMeta := range tmpl.Files {
+		if tmplMeta.Exists && !tmplMeta.Changed {
+			stored = append(stored, tmplMeta)
+			continue
+		}
+		err := confirmOverwrite(tmplMeta.DestPath, tmpl.TmplOpts.Overwrite, tmpl.prompter())
+		if err != nil {
+			switch err.(type) {
+			case *ErrFileExists:
+				continue
+			default:
+				tx.Rollback()
+				return err
+			}
+		}
+		err = tx.Stage(tmplMeta.DestPath, tmplMeta.Content, tmplMeta.Mode)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		stored = append(stored, tmplMeta)
+	}
+	err := tx.Commit()
+	if err != nil {
+		return fmt.Errorf("rolled back all processed templates: %v", err)
+	}
+	if tmpl.TmplOpts.ShowProcessedFile {
+		c := tmpl.colors()
+		for _, tmplMeta := range stored {
+			c.ExecInfo.Fprintf(tmpl.out(), "'%s' is processed and stored in '%s' (%s)\n", tmplMeta.OrigPath, tmplMeta.DestPath, tmplMeta.Status())
 		}
 	}
 	return nil
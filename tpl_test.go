@@ -0,0 +1,73 @@
+package tpl
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestResolveKey(t *testing.T) {
+	data := map[string]interface{}{
+		"servers": []interface{}{
+			map[string]interface{}{"host": "a", "port": 1},
+			map[string]interface{}{"host": "b"},
+		},
+		"ports":     []interface{}{1, 2},
+		"nested":    []interface{}{[]interface{}{"x"}, "y"},
+		"labels":    map[string]interface{}{"app": "web"},
+		"resources": map[string]interface{}{"cpu": 1},
+		"empty":     []interface{}{},
+	}
+	tests := []struct {
+		key     string
+		given   map[string]interface{}
+		missing []string
+	}{
+		{".servers[0].host", map[string]interface{}{".servers[0].host": "a", ".servers[1].host": "b"}, nil},
+		{".servers[0].port", map[string]interface{}{".servers[0].port": 1}, []string{".servers[1].port"}},
+		{".ports[0]", map[string]interface{}{".ports[0]": 1, ".ports[1]": 2}, nil},
+		{".nested", map[string]interface{}{".nested[0][0]": "x", ".nested[1]": "y"}, nil},
+		{".labels[0]", map[string]interface{}{".labels.app": "web"}, nil},
+		{".resources", map[string]interface{}{".resources.cpu": 1}, nil},
+		{".empty[0].x", map[string]interface{}{".empty": []interface{}{}}, nil},
+		{".db.host", map[string]interface{}{}, []string{".db.host"}},
+		{".list[0].name", map[string]interface{}{}, []string{".list[0].name"}},
+	}
+	for _, tc := range tests {
+		given := make(map[string]interface{})
+		var missing []string
+		resolveKey(data, splitKey(tc.key), "", given, &missing)
+		sort.Strings(missing)
+		if !reflect.DeepEqual(given, tc.given) {
+			t.Errorf("resolveKey(%s) given %v, want %v", tc.key, given, tc.given)
+		}
+		if !reflect.DeepEqual(missing, tc.missing) {
+			t.Errorf("resolveKey(%s) missing %v, want %v", tc.key, missing, tc.missing)
+		}
+	}
+}
+
+func TestCleanRelPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+		ok   bool
+	}{
+		{"a/b.yaml", "a/b.yaml", true},
+		{"./a/./b", "a/b", true},
+		{"a/../b", "b", true},
+		{"", "", false},
+		{"/etc/passwd", "", false},
+		{"../escaped", "", false},
+		{"a/../../escaped", "", false},
+		{"..", "", false},
+		{"a//b", "", false},
+		{"a/", "", false},
+	}
+	for _, tc := range tests {
+		got, err := cleanRelPath(tc.path)
+		if (err == nil) != tc.ok || got != tc.want {
+			t.Errorf("cleanRelPath(%q) = %q, %v", tc.path, got, err)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package tpl
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ValueTypes are the types of the type hints like 'key:int=3' and the type options
+var ValueTypes = []string{"string", "int", "float", "bool", "null", "json"}
+
+func validValueType(typ string) bool {
+	for _, t := range ValueTypes {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// splitTypeHint splits a key like 'a.b:int' into the key and the type
+func splitTypeHint(key string) (string, string, error) {
+	i := strings.LastIndex(key, ":")
+	if i < 0 {
+		return key, "", nil
+	}
+	typ := strings.ToLower(strings.TrimSpace(key[i+1:]))
+	if !validValueType(typ) {
+		return "", "", fmt.Errorf("type '%s' is not one of %s", typ, strings.Join(ValueTypes, ", "))
+	}
+	return strings.TrimSpace(key[:i]), typ, nil
+}
+
+// convertValue converts the string to the value of the type
+func convertValue(value string, typ string) (interface{}, error) {
+	switch typ {
+	case "", "string":
+		return value, nil
+	case "int":
+		i, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("'%s' is not an int", value)
+		}
+		return i, nil
+	case "float":
+		f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return nil, fmt.Errorf("'%s' is not a float", value)
+		}
+		return f, nil
+	case "bool":
+		switch strings.ToLower(strings.TrimSpace(value)) {
+		case "true", "t", "1", "yes", "y", "on":
+			return true, nil
+		case "false", "f", "0", "no", "n", "off":
+			return false, nil
+		}
+		return nil, fmt.Errorf("'%s' is not a bool", value)
+	case "null":
+		if v := strings.TrimSpace(value); v != "" && v != "null" {
+			return nil, fmt.Errorf("'%s' is not null", value)
+		}
+		return nil, nil
+	case "json":
+		var v interface{}
+		err := json.Unmarshal([]byte(value), &v)
+		if err != nil {
+			return nil, fmt.Errorf("'%s' is not json: %v", value, err)
+		}
+		return normalizeValue(v), nil
+	}
+	return nil, fmt.Errorf("unknown type '%s'", typ)
+}
+
+var floatRe = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][-+]?[0-9]+)?$`)
+
+// inferValue converts 'true', 'false', 'null', integers, floats and json objects and lists.
+// The other values, and numbers with leading zeros like '007', are kept as strings
+func inferValue(value string) interface{} {
+	switch value {
+	case "true":
+		return true
+	case "false":
+		return false
+	case "null":
+		return nil
+	}
+	if floatRe.MatchString(value) {
+		if i, err := strconv.Atoi(value); err == nil {
+			return i
+		}
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	}
+	if strings.HasPrefix(value, "{") || strings.HasPrefix(value, "[") {
+		if v, err := convertValue(value, "json"); err == nil {
+			return v
+		}
+	}
+	return value
+}
+
+// inferTypes infers the types of the strings in the value
+func inferTypes(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		return inferValue(v)
+	case map[string]interface{}:
+		for key, val := range v {
+			v[key] = inferTypes(val)
+		}
+	case []interface{}:
+		for i, val := range v {
+			v[i] = inferTypes(val)
+		}
+	}
+	return value
+}
+
+// parseTypes parses the type options like 'a.b=int' into the types of the keys
+func parseTypes(types []string) (map[string]string, error) {
+	m := make(map[string]string)
+	for _, str := range types {
+		for _, pair := range strings.Split(str, ",") {
+			elems := strings.SplitN(pair, "=", 2)
+			if len(elems) != 2 || strings.TrimSpace(elems[0]) == "" {
+				return nil, fmt.Errorf("wrong type option '%s': key=type is expected", pair)
+			}
+			typ := strings.ToLower(strings.TrimSpace(elems[1]))
+			if !validValueType(typ) {
+				return nil, fmt.Errorf("wrong type option '%s': type '%s' is not one of %s", pair, typ, strings.Join(ValueTypes, ", "))
+			}
+			m[appendKeyPrefix(strings.TrimSpace(elems[0]))] = typ
+		}
+	}
+	return m, nil
+}
+
+// expectedType returns the type declared for the key by the type options or the schema,
+// or the type of the value the data already has for the key
+func (tmpl *Tmpl) expectedType(key string) string {
+	if typ, ok := tmpl.types[key]; ok {
+		return typ
+	}
+	if typ := tmpl.Schema.valueType(key); typ != "" {
+		return typ
+	}
+	value, _ := lookupKey(tmpl.Data, key)
+	switch value.(type) {
+	case bool:
+		return "bool"
+	case int, int64:
+		return "int"
+	case float64:
+		return "float"
+	}
+	return ""
+}
+
+// coerceValue converts the string of the key read from env or input
+// to the expected type of the key, or to the inferred type with InferTypes
+func (tmpl *Tmpl) coerceValue(key string, value string) (interface{}, error) {
+	if typ := tmpl.expectedType(key); typ != "" {
+		return convertValue(value, typ)
+	}
+	if tmpl.TmplOpts.InferTypes {
+		return inferValue(value), nil
+	}
+	return value, nil
+}
+
+// applyTypes converts the string values of the keys of the type options
+func (tmpl *Tmpl) applyTypes() error {
+	for key, typ := range tmpl.types {
+		str, ok := lookupString(tmpl.Data, key)
+		if !ok {
+			continue
+		}
+		value, err := convertValue(str, typ)
+		if err != nil {
+			return fmt.Errorf("wrong value of '%s' from '%s': %v", key, tmpl.KeySource(key), err)
+		}
+		setValue(tmpl.Data, key, value)
+	}
+	return nil
+}
+
+func lookupString(data map[string]interface{}, key string) (string, bool) {
+	value, _ := lookupKey(data, key)
+	str, ok := value.(string)
+	return str, ok
+}
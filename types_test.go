@@ -0,0 +1,131 @@
+package tpl
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInferValue(t *testing.T) {
+	tests := []struct {
+		text string
+		want interface{}
+	}{
+		{"3", 3},
+		{"-12", -12},
+		{"0", 0},
+		{"1.5", 1.5},
+		{"-0.25", -0.25},
+		{"1e3", 1000.0},
+		{"true", true},
+		{"false", false},
+		{"null", nil},
+		{`{"a": [1, "x"]}`, map[string]interface{}{"a": []interface{}{1.0, "x"}}},
+		{"[1, 2]", []interface{}{1.0, 2.0}},
+		{"007", "007"},
+		{"1.", "1."},
+		{"+1", "+1"},
+		{"True", "True"},
+		{"yes", "yes"},
+		{"{a,b}", "{a,b}"},
+		{"", ""},
+		{"web", "web"},
+		{"99999999999999999999", 1e20},
+	}
+	for _, tc := range tests {
+		if got := inferValue(tc.text); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("inferValue(%q) = %#v, want %#v", tc.text, got, tc.want)
+		}
+	}
+}
+
+func TestSplitTypeHint(t *testing.T) {
+	tests := []struct {
+		text string
+		key  string
+		typ  string
+		err  string
+	}{
+		{"a", "a", "", ""},
+		{"a.b:int", "a.b", "int", ""},
+		{"a[0]: Float ", "a[0]", "float", ""},
+		{"a:string", "a", "string", ""},
+		{"a:json", "a", "json", ""},
+		{"a:b:bool", "a:b", "bool", ""},
+		{"a:number", "", "", "type 'number' is not one of string, int, float, bool, null, json"},
+		{"a:", "", "", "type '' is not one of"},
+	}
+	for _, tc := range tests {
+		key, typ, err := splitTypeHint(tc.text)
+		if tc.err != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), tc.err) {
+				t.Errorf("splitTypeHint(%q): got error %v, want %s", tc.text, err, tc.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("splitTypeHint(%q): %v", tc.text, err)
+			continue
+		}
+		if key != tc.key || typ != tc.typ {
+			t.Errorf("splitTypeHint(%q) = %q, %q, want %q, %q", tc.text, key, typ, tc.key, tc.typ)
+		}
+	}
+}
+
+func TestConvertValue(t *testing.T) {
+	tests := []struct {
+		text string
+		typ  string
+		want interface{}
+		err  string
+	}{
+		{"010", "string", "010", ""},
+		{"x", "", "x", ""},
+		{" 3 ", "int", 3, ""},
+		{"3.5", "int", nil, "'3.5' is not an int"},
+		{"2", "float", 2.0, ""},
+		{"x", "float", nil, "'x' is not a float"},
+		{"yes", "bool", true, ""},
+		{"Off", "bool", false, ""},
+		{"maybe", "bool", nil, "'maybe' is not a bool"},
+		{"", "null", nil, ""},
+		{"null", "null", nil, ""},
+		{"x", "null", nil, "'x' is not null"},
+		{`{"a": 1}`, "json", map[string]interface{}{"a": 1.0}, ""},
+		{"{a}", "json", nil, "'{a}' is not json"},
+		{"x", "date", nil, "unknown type 'date'"},
+	}
+	for _, tc := range tests {
+		got, err := convertValue(tc.text, tc.typ)
+		if tc.err != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), tc.err) {
+				t.Errorf("convertValue(%q, %s): got error %v, want %s", tc.text, tc.typ, err, tc.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("convertValue(%q, %s): %v", tc.text, tc.typ, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("convertValue(%q, %s) = %#v, want %#v", tc.text, tc.typ, got, tc.want)
+		}
+	}
+}
+
+func TestParseTypes(t *testing.T) {
+	got, err := parseTypes([]string{"port=int,db.ssl=Bool", "tags=json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{".port": "int", ".db.ssl": "bool", ".tags": "json"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for _, types := range []string{"port", "=int", "port=number"} {
+		if _, err := parseTypes([]string{types}); err == nil || !strings.HasPrefix(err.Error(), "wrong type option") {
+			t.Errorf("parseTypes(%q): got error %v", types, err)
+		}
+	}
+}
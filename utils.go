@@ -1,11 +1,11 @@
 package tpl
 
 import (
-	"bufio"
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -14,15 +14,6 @@ import (
 	"github.com/spf13/viper"
 )
 
-func getValueStdin() string {
-	scanner := bufio.NewScanner(os.Stdin)
-	if !scanner.Scan() {
-		return ""
-	}
-	text := scanner.Text()
-	return strings.TrimSpace(text)
-}
-
 func countLeadingSpace(line string) int {
 	i := 0
 	for _, runeValue := range line {
@@ -42,22 +33,34 @@ func nestedToFlattenMap(value interface{}, list map[string]interface{}, path str
 	//case reflect.Interface:
 	//	fmt.Println("value is interface", reflect.TypeOf(value), value)
 	case map[interface{}]interface{}:
-		path = path + "."
 		xxx := value.(map[interface{}]interface{})
+		if len(xxx) == 0 && path != "" {
+			// keep empty objects to expand them again
+			list[path] = value
+			break
+		}
+		path = path + "."
 		for key, val := range xxx {
 			tpath := path + key.(string)
 			nestedToFlattenMap(val, list, tpath, false)
 		}
 	case map[string]interface{}:
-		path = path + "."
 		xxx := value.(map[string]interface{})
+		if len(xxx) == 0 && path != "" {
+			list[path] = value
+			break
+		}
+		path = path + "."
 		for key, val := range xxx {
 			tpath := path + key
 			nestedToFlattenMap(val, list, tpath, false)
 		}
 	case []interface{}:
-		path = path + "."
 		xxx := value.([]interface{})
+		if len(xxx) == 0 {
+			list[path] = value
+			break
+		}
 		for idx, val := range xxx {
 			tpath := path + "[" + strconv.Itoa(idx) + "]"
 			nestedToFlattenMap(val, list, tpath, true)
@@ -99,41 +102,238 @@ func flattenToNestedMap(value interface{}, dataMap map[string]interface{}, path
 }
 */
 
+// expand builds the data object of the flattened keys like '.a.b' and '.list[0].c'.
+// The elements missing from the lists are null
 func expand(value map[string]interface{}) map[string]interface{} {
-	return expandPrefixed(value, "")
+	keys := make([]string, 0, len(value))
+	for k := range value {
+		keys = append(keys, k)
+	}
+	// parents are set before their children
+	sort.Strings(keys)
+	data := make(map[string]interface{})
+	for _, k := range keys {
+		elems := splitKey(k)
+		if len(elems) == 0 {
+			continue
+		}
+		data[elems[0]] = setPath(data[elems[0]], elems[1:], value[k])
+	}
+	return data
 }
 
-func expandPrefixed(value map[string]interface{}, prefix string) map[string]interface{} {
-	m := make(map[string]interface{})
-	expandPrefixedToResult(value, prefix, m)
+// setPath sets the value at the path segments under the object or list,
+// creating objects and lists along the path, and returns the object or list
+func setPath(container interface{}, elems []string, value interface{}) interface{} {
+	if len(elems) == 0 {
+		return value
+	}
+	if idx, ok := keyIndex(elems[0]); ok {
+		list, _ := container.([]interface{})
+		for len(list) <= idx {
+			list = append(list, nil)
+		}
+		list[idx] = setPath(list[idx], elems[1:], value)
+		return list
+	}
+	m, ok := container.(map[string]interface{})
+	if !ok {
+		m = make(map[string]interface{})
+	}
+	m[elems[0]] = setPath(m[elems[0]], elems[1:], value)
 	return m
 }
 
-func expandPrefixedToResult(value map[string]interface{}, prefix string, result map[string]interface{}) {
-	//if prefix != "" {
-	prefix += "."
-	//}
-	for k, val := range value {
-		if !strings.HasPrefix(k, prefix) {
-			continue
+// normalizeValue converts the maps decoded from yaml to maps with string keys
+// so that the data object has the same types whatever the data format is
+func normalizeValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{})
+		for key, val := range v {
+			m[fmt.Sprintf("%v", key)] = normalizeValue(val)
 		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{})
+		for key, val := range v {
+			m[key] = normalizeValue(val)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(v))
+		for i, val := range v {
+			l[i] = normalizeValue(val)
+		}
+		return l
+	}
+	return value
+}
 
-		key := k[len(prefix):]
-		idx := strings.Index(key, ".")
-		if idx != -1 {
-			key = key[:idx]
+// fileSet holds file paths in the given order without duplicates
+type fileSet []string
+
+func (fs fileSet) has(file string) bool {
+	for _, f := range fs {
+		if filepath.Clean(f) == filepath.Clean(file) {
+			return true
 		}
-		if _, ok := result[key]; ok {
-			continue
+	}
+	return false
+}
+
+// globIncludes returns the include files of colon separated globs.
+// A directory includes the files starting with '_' in it like helm partials
+func globIncludes(includesStr string) (fileSet, error) {
+	includes := fileSet{}
+	if includesStr == "" {
+		return includes, nil
+	}
+	for _, v := range strings.Split(includesStr, ":") {
+		matches, err := filepath.Glob(v)
+		if err != nil {
+			return nil, fmt.Errorf("include glob error: %v", err)
+		}
+		for _, match := range matches {
+			fi, err := os.Stat(match)
+			if err != nil {
+				return nil, err
+			}
+			files := []string{match}
+			if fi.IsDir() {
+				files, err = filepath.Glob(filepath.Join(match, "_*"))
+				if err != nil {
+					return nil, fmt.Errorf("include glob error: %v", err)
+				}
+			}
+			for _, file := range files {
+				fi, err := os.Stat(file)
+				if err == nil && !fi.IsDir() && !includes.has(file) {
+					includes = append(includes, file)
+				}
+			}
 		}
-		if idx == -1 {
-			result[key] = val
+	}
+	return includes, nil
+}
+
+var keyIndexesRe = regexp.MustCompile(`^(.*?)((\[[0-9]+\])+)$`)
+
+// splitKey splits the flattened key like '.a.b[0].c' into its path segments
+// 'a', 'b', '[0]' and 'c'. The former form of list indexes '.b.[0]' is split the same
+func splitKey(key string) []string {
+	key = strings.TrimPrefix(key, ".")
+	if key == "" {
+		return nil
+	}
+	elems := []string{}
+	for _, part := range strings.Split(key, ".") {
+		m := keyIndexesRe.FindStringSubmatch(part)
+		if m == nil {
+			elems = append(elems, part)
 			continue
 		}
+		if m[1] != "" {
+			elems = append(elems, m[1])
+		}
+		for _, idx := range strings.SplitAfter(m[2], "]") {
+			if idx != "" {
+				elems = append(elems, idx)
+			}
+		}
+	}
+	return elems
+}
+
+var keyIndexRe = regexp.MustCompile(`\[[0-9]+\]`)
+
+// firstIndexKey replaces the list indexes of the key with '[0]'
+func firstIndexKey(key string) string {
+	return keyIndexRe.ReplaceAllString(key, "[0]")
+}
 
-		// It contains a period, so it is a more complex structure
-		result[key] = expandPrefixed(value, k[:len(prefix)+len(key)])
+// keyIndex returns the list index of a path segment like '[0]'
+func keyIndex(elem string) (int, bool) {
+	if !strings.HasPrefix(elem, "[") || !strings.HasSuffix(elem, "]") {
+		return 0, false
+	}
+	idx, err := strconv.Atoi(elem[1 : len(elem)-1])
+	return idx, err == nil && idx >= 0
+}
+
+// lookupKey returns the value of the flattened key in the data object
+func lookupKey(data interface{}, key string) (interface{}, bool) {
+	value := data
+	for _, elem := range splitKey(key) {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			val, ok := v[elem]
+			if !ok {
+				return nil, false
+			}
+			value = val
+		case []interface{}:
+			idx, ok := keyIndex(elem)
+			if !ok || idx >= len(v) {
+				return nil, false
+			}
+			value = v[idx]
+		default:
+			return nil, false
+		}
 	}
+	return value, true
+}
+
+// hasKey reports whether the key has a value in the data object or in the flattened data.
+// A key under a list that has fewer elements is regarded as present
+// because it is never evaluated, and so is a list index on an object,
+// which is the element of a range over a map.
+func hasKey(data interface{}, dataFlattenMap map[string]interface{}, key string) bool {
+	if _, ok := dataFlattenMap[key]; ok {
+		return true
+	}
+	for k := range dataFlattenMap {
+		if isParentKey(key, k) {
+			return true
+		}
+	}
+	value := data
+	for _, elem := range splitKey(key) {
+		_, isIndex := keyIndex(elem)
+		switch v := value.(type) {
+		case map[string]interface{}:
+			if isIndex {
+				return true
+			}
+			val, ok := v[elem]
+			if !ok {
+				return false
+			}
+			value = val
+		case map[interface{}]interface{}:
+			if isIndex {
+				return true
+			}
+			val, ok := v[elem]
+			if !ok {
+				return false
+			}
+			value = val
+		case []interface{}:
+			idx, ok := keyIndex(elem)
+			if !ok {
+				return false
+			}
+			if idx >= len(v) {
+				return true
+			}
+			value = v[idx]
+		default:
+			return false
+		}
+	}
+	return true
 }
 
 // CreateDirectoryIfNotExists creates a directory only if it doesn't already exist.
@@ -166,15 +366,38 @@ func (e *ErrFileExists) Error() string {
 
 // WriteStringToFileAndCreateDir writes string to the file at path `dst`, creating it if necessary.
 func WriteStringToFileAndCreateDir(dst string, content string, overwrite bool) error {
+	return WriteStringToFileWithModeAndCreateDir(dst, content, 0, overwrite)
+}
+
+// confirmOverwrite asks the prompter whether to overwrite the file at path `dst` if it exists
+func confirmOverwrite(dst string, overwrite bool, p Prompter) error {
 	if !overwrite {
 		if _, err := os.Stat(dst); !os.IsNotExist(err) {
-			fmt.Printf("tpl: overwrite '%s'? ", dst)
-			val := strings.ToLower(getValueStdin())
-			if !strings.HasPrefix(val, "y") {
+			ok, err := p.Confirm(fmt.Sprintf("tpl: overwrite '%s'?", dst))
+			if err != nil {
+				return err
+			}
+			if !ok {
 				return NewErrFileExists("file exists")
 			}
 		}
 	}
+	return nil
+}
+
+// WriteStringToFileWithModeAndCreateDir writes string to the file at path `dst` with the mode,
+// creating it if necessary. The file is replaced atomically by renaming a temporary file.
+// The mode of an existing file is kept if mode is 0
+func WriteStringToFileWithModeAndCreateDir(dst string, content string, mode os.FileMode, overwrite bool) error {
+	return writeStringToFile(dst, content, mode, overwrite, StdinPrompter())
+}
+
+// writeStringToFile is WriteStringToFileWithModeAndCreateDir asking the prompter to overwrite
+func writeStringToFile(dst string, content string, mode os.FileMode, overwrite bool, p Prompter) error {
+	err := confirmOverwrite(dst, overwrite, p)
+	if err != nil {
+		return err
+	}
 	path := filepath.Dir(dst)
 	if path != "." {
 		err := os.MkdirAll(path, os.ModePerm)
@@ -182,20 +405,7 @@ func WriteStringToFileAndCreateDir(dst string, content string, overwrite bool) e
 			return err
 		}
 	}
-	f, err := os.Create(dst)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
-	_, err = io.Copy(f, strings.NewReader(content))
-	if err != nil {
-		return err
-	}
-	// err = f.Chmod(mode)
-	// if err != nil {
-	// 	return err
-	// }
-	return nil
+	return WriteFileAtomic(dst, content, mode)
 }
 
 // NavColorMeta holds metadata for git style color
@@ -219,6 +429,23 @@ func InitializedNavColorMeta() *NavColorMeta {
 	return navColorMeta
 }
 
+// NoColorMeta returns NavColorMeta without colours
+func NoColorMeta() *NavColorMeta {
+	c := &NavColorMeta{
+		ExecInfo:   color.New(),
+		NavFile:    color.New(),
+		NavTitle:   color.New(),
+		NavContext: color.New(),
+		NavInput:   color.New(),
+	}
+	c.ExecInfo.DisableColor()
+	c.NavFile.DisableColor()
+	c.NavTitle.DisableColor()
+	c.NavContext.DisableColor()
+	c.NavInput.DisableColor()
+	return c
+}
+
 func (c *NavColorMeta) init() error {
 	execInfo := viper.GetString("color.exec.file")
 	navFile := viper.GetString("color.nav.file")
@@ -0,0 +1,48 @@
+package tpl
+
+import "testing"
+
+func TestHasKey(t *testing.T) {
+	data := map[string]interface{}{
+		"labels":  map[string]interface{}{"app": "web", "tier": "fe"},
+		"servers": []interface{}{map[string]interface{}{"host": "a"}},
+		"empty":   []interface{}{},
+		"name":    "x",
+	}
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{".name", true},
+		{".missing", false},
+		{".labels.app", true},
+		{".labels.none", false},
+		// range $k, $v := .labels
+		{".labels[0]", true},
+		{".labels[0].x", true},
+		{".servers[0].host", true},
+		{".servers[0].port", false},
+		// lists with fewer elements are never evaluated
+		{".servers[1].host", true},
+		{".empty[0]", true},
+		{".name.x", false},
+		{".name[0]", false},
+	}
+	for _, tc := range tests {
+		if got := hasKey(data, map[string]interface{}{}, tc.key); got != tc.want {
+			t.Errorf("hasKey(%s) = %v, want %v", tc.key, got, tc.want)
+		}
+	}
+}
+
+func TestHasKeyFlattened(t *testing.T) {
+	flat := map[string]interface{}{".db.host": "h"}
+	for _, key := range []string{".db.host", ".db"} {
+		if !hasKey(map[string]interface{}{}, flat, key) {
+			t.Errorf("hasKey(%s) = false, want true", key)
+		}
+	}
+	if hasKey(map[string]interface{}{}, flat, ".db.port") {
+		t.Errorf("hasKey(.db.port) = true, want false")
+	}
+}
@@ -0,0 +1,147 @@
+package tpl
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ignoreFile is read from the root of a template directory
+const ignoreFile = ".tplignore"
+
+// tmplExts are the extensions of template files in a template directory
+var tmplExts = []string{".tpl", ".tmpl"}
+
+// TmplDirFiles holds files found by walking a template directory
+type TmplDirFiles struct {
+	Root      string
+	TmplFiles []string
+	CopyFiles []string
+	Partials  []string
+}
+
+func isTmplFile(file string) bool {
+	for _, ext := range tmplExts {
+		if strings.HasSuffix(file, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+func trimTmplExt(file string) string {
+	for _, ext := range tmplExts {
+		if strings.HasSuffix(file, ext) {
+			return strings.TrimSuffix(file, ext)
+		}
+	}
+	return file
+}
+
+// globList holds colon separated globs matched against a relative path
+type globList []string
+
+func splitGlobs(globsStr string) globList {
+	globs := globList{}
+	for _, g := range strings.Split(globsStr, ":") {
+		if g != "" {
+			globs = append(globs, g)
+		}
+	}
+	return globs
+}
+
+// match reports whether the relative path or its base name matches any glob.
+// A glob ending with '/' only matches directories
+func (globs globList) match(rel string, isDir bool) bool {
+	for _, g := range globs {
+		if strings.HasSuffix(g, "/") {
+			if !isDir {
+				continue
+			}
+			g = strings.TrimSuffix(g, "/")
+		}
+		g = strings.TrimPrefix(g, "/")
+		if ok, _ := filepath.Match(g, rel); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(g, filepath.Base(rel)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func readIgnoreFile(root string) (globList, error) {
+	f, err := os.Open(filepath.Join(root, ignoreFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return globList{}, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	globs := globList{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		globs = append(globs, line)
+	}
+	return globs, scanner.Err()
+}
+
+// WalkTmplDir walks the directory and sorts its files into templates,
+// partials starting with '_' and files to copy as they are.
+// Files matching exclude globs or the globs of '.tplignore' are skipped,
+// and only files matching the match globs are used if any
+func WalkTmplDir(root string, match, exclude globList) (*TmplDirFiles, error) {
+	ignore, err := readIgnoreFile(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read '%s': %v", ignoreFile, err)
+	}
+	ignore = append(ignore, exclude...)
+	dirFiles := &TmplDirFiles{Root: root}
+	err = filepath.Walk(root, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, file)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		if info.IsDir() {
+			if ignore.match(rel, true) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if rel == ignoreFile || rel == schemaFile || ignore.match(rel, false) {
+			return nil
+		}
+		if len(match) > 0 && !match.match(rel, false) {
+			return nil
+		}
+		switch {
+		case !isTmplFile(file):
+			dirFiles.CopyFiles = append(dirFiles.CopyFiles, file)
+		case strings.HasPrefix(info.Name(), "_"):
+			dirFiles.Partials = append(dirFiles.Partials, file)
+		default:
+			dirFiles.TmplFiles = append(dirFiles.TmplFiles, file)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return dirFiles, nil
+}